@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/natiiix/uniquery/pkg/runner"
+)
+
+// input is a file to process along with the format of its content.
+type input struct {
+	path   string
+	format format
+}
+
+// listFlag collects the values of a repeated flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(arg string) error {
+	*l = append(*l, arg)
+	return nil
+}
+
+// formatByExtension determines the format of a file from its extension.
+func formatByExtension(path string) (format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		return ndjsonFormat, true
+	}
+
+	if f, ok := runner.FormatByExtension(path); ok {
+		return newFormat(f), true
+	}
+	return format{}, false
+}
+
+// detectFormat determines the format of a file from its extension or, if it is unknown, from its content.
+func detectFormat(path string) (format, error) {
+	if f, ok := formatByExtension(path); ok {
+		return f, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return format{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return format{}, err
+	} else if f, ok := runner.DetectFormat(path, head[:n]); ok {
+		return newFormat(f), nil
+	}
+	return format{}, fmt.Errorf("unknown format of %s (use -format)", path)
+}
+
+// matchesAny checks whether the base name of the path matches any of the shell patterns.
+func matchesAny(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded checks whether a file found in a directory should be processed.
+// Without include patterns, all files of known formats are included.
+func isIncluded(path string) bool {
+	if matchesAny(path, excludePatterns) {
+		return false
+	} else if len(includePatterns) > 0 {
+		return matchesAny(path, includePatterns)
+	}
+
+	_, known := formatByExtension(path)
+	return known
+}
+
+// expandPath expands a glob pattern. Paths without any pattern characters are returned as they are,
+// so that missing files are reported when they are opened.
+func expandPath(path string) ([]string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, err
+	} else if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", path)
+	}
+	return matches, nil
+}
+
+// walkDirectory lists the included files within the directory and its subdirectories in lexical order.
+// Excluded directories are skipped entirely.
+func walkDirectory(root string) ([]string, error) {
+	paths := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != root && matchesAny(path, excludePatterns) {
+				return filepath.SkipDir
+			}
+		} else if isIncluded(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// collectInputs lists the files specified by the -json, -yaml and -ndjson flags and by the positional arguments.
+// The format of positional arguments is specified by -format or determined by their extensions and content.
+// Directories are searched only in the recursive mode (-r). Files specified more than once (by overlapping
+// globs, directories or different forms of the same path) are processed once, in the format of their first occurrence.
+func collectInputs(args []string) ([]input, error) {
+	inputs := []input{}
+	seen := map[string]bool{}
+
+	var argsFormat *format
+	if f, ok := formatByName(formatName); ok {
+		argsFormat = &f
+	}
+
+	jsonFormat, yamlFormat := newFormat(runner.JsonFormat), newFormat(runner.YamlFormat)
+	for _, paths := range []struct {
+		patterns []string
+		format   *format
+	}{
+		{jsonPaths, &jsonFormat},
+		{yamlPaths, &yamlFormat},
+		{ndjsonPaths, &ndjsonFormat},
+		{args, argsFormat},
+	} {
+		for _, pattern := range paths.patterns {
+			expanded, err := expandPath(pattern)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, path := range expanded {
+				files := []string{path}
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					if !recursive {
+						return nil, fmt.Errorf("%s is a directory (use -r to search directories)", path)
+					} else if files, err = walkDirectory(path); err != nil {
+						return nil, err
+					}
+				}
+
+				for _, file := range files {
+					absolute, err := filepath.Abs(file)
+					if err != nil {
+						return nil, err
+					} else if seen[absolute] {
+						continue
+					}
+					seen[absolute] = true
+
+					if paths.format != nil {
+						inputs = append(inputs, input{path: file, format: *paths.format})
+					} else if f, err := detectFormat(file); err == nil {
+						inputs = append(inputs, input{path: file, format: f})
+					} else {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+// processInputs processes the inputs using a bounded number of concurrent workers.
+// Results are passed to the report function in the order of the inputs, as soon as they are available.
+// It returns after all inputs have been processed and reported, even if some of them have failed.
+func processInputs(inputs []input, workers int, process func(input) (string, error), report func(input, string, error)) {
+	type result struct {
+		output string
+		err    error
+		done   chan struct{}
+	}
+
+	results := make([]result, len(inputs))
+	for i := range results {
+		results[i].done = make(chan struct{})
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].output, results[i].err = process(inputs[i])
+				close(results[i].done)
+			}
+		}()
+	}
+
+	go func() {
+		for i := range inputs {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for i := range results {
+		<-results[i].done
+		report(inputs[i], results[i].output, results[i].err)
+	}
+
+	wg.Wait()
+}
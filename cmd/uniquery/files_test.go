@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testFiles are created in a temporary directory by createTestFiles.
+var testFiles = map[string]string{
+	"a.json":          `{"name": "a"}`,
+	"b.yaml":          "name: b\n",
+	"logs.ndjson":     "{\"name\": \"c\"}\n",
+	"notes.txt":       "name: d\n",
+	"sub/c.json":      `{"name": "c"}`,
+	"sub/d.yml":       "name: d\n",
+	"vendor/e.json":   `{"name": "e"}`,
+	"config":          `{"name": "f"}`,
+	"unknown/g.data":  "?",
+	"unknown/h.cache": "?",
+}
+
+func createTestFiles(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "uniquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range testFiles {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// formatNameOf returns the name of the format of an input, as accepted by -format.
+func formatNameOf(f format) string {
+	if f.Format == nil {
+		return "ndjson"
+	}
+	return f.Name()
+}
+
+var testTabCollectInputs = []struct {
+	jsonPaths []string
+	args      []string
+	recursive bool
+	exclude   []string
+	inputs    []string
+}{
+	{nil, []string{"a.json", "b.yaml"}, false, nil, []string{"a.json json", "b.yaml yaml"}},
+	{nil, []string{"*.json", "*.yaml"}, false, nil, []string{"a.json json", "b.yaml yaml"}},
+	// The format of files with unknown extensions is detected from their content.
+	{nil, []string{"config"}, false, nil, []string{"config json"}},
+	{nil, []string{"."}, true, nil, []string{"a.json json", "b.yaml yaml", "logs.ndjson ndjson", "sub/c.json json", "sub/d.yml yaml", "vendor/e.json json"}},
+	{nil, []string{"."}, true, []string{"vendor", "*.yml"}, []string{"a.json json", "b.yaml yaml", "logs.ndjson ndjson", "sub/c.json json"}},
+	// Files are processed once, in the format of their first occurrence.
+	{[]string{"a.json"}, []string{"a.json", "./a.json", "sub/../a.json", "*.json"}, false, nil, []string{"a.json json"}},
+	{nil, []string{"sub/c.json", "sub", "."}, true, nil, []string{"sub/c.json json", "sub/d.yml yaml", "a.json json", "b.yaml yaml", "logs.ndjson ndjson", "vendor/e.json json"}},
+}
+
+var testTabCollectInputsErrors = []struct {
+	args      []string
+	recursive bool
+}{
+	{[]string{"sub"}, false},
+	{[]string{"*.missing"}, false},
+	{[]string{"unknown/g.data"}, false},
+	{[]string{"["}, false},
+}
+
+func TestCollectInputs(t *testing.T) {
+	dir := createTestFiles(t)
+	defer os.RemoveAll(dir)
+
+	// Relative paths are resolved from the temporary directory, so that they are the same as in the table.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	defer func(originalJSON listFlag, originalRecursive bool, originalExclude listFlag) {
+		jsonPaths, recursive, excludePatterns = originalJSON, originalRecursive, originalExclude
+	}(jsonPaths, recursive, excludePatterns)
+
+	for index, entry := range testTabCollectInputs {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			jsonPaths, recursive, excludePatterns = entry.jsonPaths, entry.recursive, entry.exclude
+
+			inputs, err := collectInputs(entry.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			described := []string{}
+			for _, in := range inputs {
+				described = append(described, fmt.Sprintf("%s %s", filepath.ToSlash(in.path), formatNameOf(in.format)))
+			}
+
+			if !cmp.Equal(described, entry.inputs) {
+				t.Errorf("Unexpected inputs of %q: %v instead of %v", entry.args, described, entry.inputs)
+			}
+		})
+	}
+
+	jsonPaths, excludePatterns = nil, nil
+	for index, entry := range testTabCollectInputsErrors {
+		t.Run(fmt.Sprintf("error %d", index), func(t *testing.T) {
+			recursive = entry.recursive
+			if inputs, err := collectInputs(entry.args); err == nil {
+				t.Errorf("Arguments %q were expected to fail, got %v", entry.args, inputs)
+			}
+		})
+	}
+}
+
+func TestProcessInputs(t *testing.T) {
+	inputs := []input{}
+	for i := 0; i < 20; i++ {
+		inputs = append(inputs, input{path: strconv.Itoa(i)})
+	}
+
+	reported := []string{}
+	processInputs(inputs, 4, func(in input) (string, error) {
+		if i, _ := strconv.Atoi(in.path); i%5 == 0 {
+			return "", errors.New("failed")
+		}
+		return in.path, nil
+	}, func(in input, output string, err error) {
+		if err != nil {
+			output = err.Error()
+		}
+		reported = append(reported, output)
+	})
+
+	// Failed inputs do not stop the others and all inputs are reported in order.
+	expected := []string{}
+	for i := range inputs {
+		if i%5 == 0 {
+			expected = append(expected, "failed")
+		} else {
+			expected = append(expected, strconv.Itoa(i))
+		}
+	}
+	if !cmp.Equal(reported, expected) {
+		t.Errorf("Unexpected reported results: %v instead of %v", reported, expected)
+	}
+}
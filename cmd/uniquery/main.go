@@ -1,57 +1,498 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/natiiix/uniquery"
+	"github.com/natiiix/uniquery/pkg/parser"
 	"github.com/natiiix/uniquery/pkg/runner"
 )
 
+type mutation struct {
+	query  string
+	value  string
+	delete bool
+}
+
 var (
-	query    string = ""
-	jsonPath string = ""
-	yamlPath string = ""
-	verbose  bool   = false
+	query           string = ""
+	jsonPaths              = listFlag{}
+	yamlPaths              = listFlag{}
+	ndjsonPaths            = listFlag{}
+	formatName      string = ""
+	verbose         bool   = false
+	inPlace         bool   = false
+	backup          bool   = false
+	locations       bool   = false
+	pathFormat             = runner.CanonicalPath
+	dialect                = parser.UniQueryDialect
+	stream          bool   = false
+	yamlStreams     bool   = false
+	recursive       bool   = false
+	includePatterns        = listFlag{}
+	excludePatterns        = listFlag{}
+	limits                 = runner.Limits{}
+	jobs            int    = runtime.NumCPU()
+	mutations              = []mutation{}
+	inputs                 = []input{}
 )
 
+// queryRunner evaluates queries with the options specified by the flags.
+var queryRunner *runner.Runner
+
+type setFlag struct{}
+
+func (setFlag) String() string {
+	return ""
+}
+
+func (setFlag) Set(arg string) error {
+	query, value, err := splitAssignment(arg)
+	if err != nil {
+		return err
+	}
+
+	mutations = append(mutations, mutation{query: query, value: value})
+	return nil
+}
+
+type pathFormatFlag struct{}
+
+func (pathFormatFlag) String() string {
+	return string(pathFormat)
+}
+
+func (pathFormatFlag) Set(arg string) error {
+	for _, format := range runner.PathFormats {
+		if string(format) == arg {
+			pathFormat = format
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown path format %s (available formats are canonical, pointer and jsonpath)", arg)
+}
+
+type dialectFlag struct{}
+
+func (dialectFlag) String() string {
+	return string(dialect)
+}
+
+func (dialectFlag) Set(arg string) error {
+	for _, d := range parser.Dialects {
+		if string(d) == arg {
+			dialect = d
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown dialect %s (available dialects are uniquery and jsonpath)", arg)
+}
+
+type deleteFlag struct{}
+
+func (deleteFlag) String() string {
+	return ""
+}
+
+func (deleteFlag) Set(arg string) error {
+	mutations = append(mutations, mutation{query: arg, delete: true})
+	return nil
+}
+
+// splitAssignment splits `query=value` at the last equality sign, which is neither escaped nor quoted.
+// The query may therefore contain equality filters, but an equality sign in the value must be quoted.
+func splitAssignment(arg string) (string, string, error) {
+	runes := []rune(arg)
+	split := -1
+	escaped := false
+	quoted := false
+
+	for i, r := range runes {
+		if escaped {
+			escaped = false
+		} else if r == '"' {
+			quoted = !quoted
+		} else if r == '\\' && !quoted {
+			escaped = true
+		} else if r == '=' && !quoted {
+			split = i
+		}
+	}
+
+	if split < 0 {
+		return "", "", fmt.Errorf("expected query=value, got %q", arg)
+	}
+
+	return string(runes[:split]), string(runes[split+1:]), nil
+}
+
 func init() {
 	flag.StringVar(&query, "query", query, "Query to run on the data")
-	flag.StringVar(&jsonPath, "json", jsonPath, "Path of a JSON file to run the query on")
-	flag.StringVar(&yamlPath, "yaml", jsonPath, "Path of a YAML file to run the query on")
+	flag.Var(dialectFlag{}, "dialect", "Language of queries (`name` of uniquery or jsonpath, default is uniquery)")
+	flag.Var(&jsonPaths, "json", "Path of a JSON file to run the query on (may be repeated)")
+	flag.Var(&yamlPaths, "yaml", "Path of a YAML file to run the query on (may be repeated)")
+	flag.Var(&ndjsonPaths, "ndjson", "Path of a JSON Lines (NDJSON) file to run the query on record by record (may be repeated)")
+	flag.StringVar(&formatName, "format", formatName, "Format of the files specified after the flags (`name` of a registered format, such as json, yaml or ndjson), detected by their extensions or content by default")
+	flag.BoolVar(&yamlStreams, "yaml-streams", yamlStreams, "Query every YAML file as an array of its documents, even if it has only one (files with multiple documents always are)")
+	flag.BoolVar(&recursive, "r", recursive, "Search directories recursively")
+	flag.Var(&includePatterns, "include", "Search only files whose names match a `pattern` in directories (may be repeated, default is all JSON and YAML files)")
+	flag.Var(&excludePatterns, "exclude", "Skip files and directories whose names match a `pattern` in directories (may be repeated)")
+	flag.IntVar(&jobs, "j", jobs, "Number of files processed concurrently")
 	flag.BoolVar(&verbose, "v", verbose, "Enable verbose mode - additional information will be printed, mostly for debugging purposes")
+	flag.BoolVar(&locations, "locations", locations, "Print results to the standard output prefixed by their `file:line:column` locations")
+	flag.Var(pathFormatFlag{}, "paths", "Format of result paths (`name` of canonical, pointer or jsonpath, default is canonical)")
+	flag.BoolVar(&stream, "stream", stream, "Query JSON files without decoding them entirely, if the query does not use parent navigation or operators (positions of results are not known)")
+	flag.DurationVar(&limits.Timeout, "timeout", limits.Timeout, "Maximum `duration` of the evaluation of a query on a single file (e.g. 10s, default is no limit)")
+	flag.IntVar(&limits.MaxDepth, "max-depth", limits.MaxDepth, "Maximum depth of elements visited by a query (default is no limit)")
+	flag.IntVar(&limits.MaxNodes, "max-nodes", limits.MaxNodes, "Maximum number of elements visited by a query in a single file (default is no limit)")
+	flag.IntVar(&limits.MaxResults, "max-results", limits.MaxResults, "Maximum number of results of a query in a single file (default is no limit)")
+	flag.Var(setFlag{}, "set", "Set elements selected by a query to a value (`query=value`, value is parsed in the format of the file, may be repeated)")
+	flag.Var(deleteFlag{}, "delete", "Delete elements selected by a `query` (may be repeated)")
+	flag.BoolVar(&inPlace, "i", inPlace, "Write modified documents back to their files instead of the standard output")
+	flag.BoolVar(&backup, "backup", backup, "Keep a copy of each file modified in place with the .bak suffix")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file or glob ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// parseFlags parses and validates the command line. Queries are checked before any file is processed.
+func parseFlags() {
 	flag.Parse()
 
-	if jsonPath == "" && yamlPath == "" {
+	if _, known := formatByName(formatName); formatName != "" && !known {
+		log.Fatalf("Unknown format %s (available formats are %s)\n", formatName, strings.Join(formatNames(), ", "))
+	}
+
+	var err error
+	if inputs, err = collectInputs(flag.Args()); err != nil {
+		log.Fatalln(err)
+	} else if len(inputs) == 0 {
 		log.Fatalln("Please specify an input file path")
 	}
 
-	runner.Verbose = verbose
+	if len(mutations) > 0 && query != "" {
+		log.Fatalln("Query cannot be combined with -set or -delete")
+	} else if len(mutations) == 0 && (inPlace || backup) {
+		log.Fatalln("In-place editing requires -set or -delete")
+	} else if locations && len(mutations) > 0 {
+		log.Fatalln("Locations cannot be combined with -set or -delete")
+	} else if stream && len(mutations) > 0 {
+		log.Fatalln("Streaming cannot be combined with -set or -delete")
+	} else if backup && !inPlace {
+		log.Fatalln("Backup can only be made when editing in place (-i)")
+	} else if jobs < 1 {
+		log.Fatalln("Number of concurrently processed files must be positive")
+	} else if limits.Timeout < 0 || limits.MaxDepth < 0 || limits.MaxNodes < 0 || limits.MaxResults < 0 {
+		log.Fatalln("Limits must not be negative")
+	}
+
+	queries := []string{}
+	if len(mutations) == 0 {
+		queries = append(queries, query)
+	}
+	for _, m := range mutations {
+		queries = append(queries, m.query)
+	}
+	compile := uniquery.Compile
+	if dialect == parser.JSONPathDialect {
+		compile = uniquery.CompileJSONPath
+	}
+	for _, q := range queries {
+		if _, err := compile(q); err != nil {
+			log.Fatalf("Invalid query `%s`: %v\n", q, err)
+		}
+	}
+
+	queryRunner = runner.NewRunner(runner.Options{Verbose: verbose, Limits: limits, Dialect: dialect, YAMLStreams: yamlStreams})
 }
 
-func main() {
-	results := map[string]runner.Element{}
+// format is the format of an input file. Formats which can only be streamed (JSON Lines) have no runner format.
+type format struct {
+	runner.Format
+	// stream runs a query on the file without decoding all of it. Formats without runner format are always streamed.
+	stream streamFunc
+}
 
-	if jsonPath != "" {
-		if jsonResults, err := runner.RunJsonFile(query, jsonPath); err != nil {
-			log.Fatalln(err)
-		} else {
-			for k, v := range jsonResults {
-				results[k] = v
-			}
+// streamFunc runs a query on a file and emits its results as soon as they are found.
+type streamFunc func(r *runner.Runner, query string, path string, emit func(runner.Element) error) error
+
+var (
+	ndjsonFormat = format{stream: (*runner.Runner).RunNdjsonFile}
+	// streams run queries on files of registered formats without decoding them entirely.
+	streams = map[string]streamFunc{
+		runner.JsonFormat.Name(): (*runner.Runner).RunJsonStreamFile,
+	}
+	// valueParsers parse values specified on the command line. Other formats decode them like documents.
+	valueParsers = map[string]func(string) (interface{}, error){
+		runner.YamlFormat.Name(): parseYaml,
+	}
+)
+
+// newFormat wraps a registered format.
+func newFormat(f runner.Format) format {
+	return format{Format: f, stream: streams[f.Name()]}
+}
+
+// formatByName returns the format of the name, which is either JSON Lines or a registered format.
+func formatByName(name string) (format, bool) {
+	if strings.ToLower(name) == "ndjson" {
+		return ndjsonFormat, true
+	} else if f, ok := runner.FormatByName(name); ok {
+		return newFormat(f), true
+	}
+	return format{}, false
+}
+
+// formatNames lists the names of all formats.
+func formatNames() []string {
+	names := []string{}
+	for _, f := range runner.Formats() {
+		names = append(names, f.Name())
+	}
+	return append(names, "ndjson")
+}
+
+func parseYaml(value string) (interface{}, error) {
+	var parsed interface{}
+	err := yaml.Unmarshal([]byte(value), &parsed)
+	return parsed, err
+}
+
+// parseValue parses the value in the format of the modified file. Values which cannot be parsed are used as strings.
+func (f format) parseValue(value string) interface{} {
+	if parse, ok := valueParsers[f.Name()]; ok {
+		if parsed, err := parse(value); err == nil {
+			return parsed
 		}
+		return value
 	}
 
-	if yamlPath != "" {
-		if yamlResults, err := runner.RunYamlFile(query, yamlPath); err != nil {
-			log.Fatalln(err)
+	parsed, err := queryRunner.Decode(f.Format, strings.NewReader(value))
+	if err != nil {
+		return value
+	} else if doc, ok := parsed.(*runner.Document); ok {
+		return doc.Root
+	}
+	return parsed
+}
+
+// decodeFile decodes the document stored in the file.
+func decodeFile(path string, f format) (interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return queryRunner.Decode(f.Format, file)
+}
+
+// modifyFile applies the modifications to the document in the file. The modified document is written
+// to the output, unless it is written back to the file.
+func modifyFile(path string, f format, output io.Writer) error {
+	if f.Format == nil {
+		return fmt.Errorf("file cannot be modified, because it can only be streamed")
+	}
+
+	root, err := decodeFile(path, f)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mutations {
+		if m.delete {
+			root, err = queryRunner.Delete(root, m.query)
 		} else {
-			for k, v := range yamlResults {
-				results[k] = v
+			root, err = queryRunner.Set(root, m.query, f.parseValue(m.value))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	if err := queryRunner.Encode(f.Format, &buffer, root); err != nil {
+		return err
+	}
+
+	if !inPlace {
+		_, err := output.Write(buffer.Bytes())
+		return err
+	}
+
+	if verbose {
+		log.Printf("Writing modified document to %s\n", path)
+	}
+	return writeFileAtomic(path, buffer.Bytes())
+}
+
+// writeFileAtomic writes the data to a temporary file, which then replaces the original file.
+// Since renaming is atomic, the original file is never left partially written.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Removing the temporary file fails after a successful rename, which is fine.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	} else if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	if backup {
+		original, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := ioutil.WriteFile(path+".bak", original, info.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// formatValue formats the value as JSON, so that numbers are printed with their original literal.
+// Values which cannot be represented in JSON are formatted using the Go syntax.
+func formatValue(value interface{}) string {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err == nil {
+		return strings.TrimSuffix(buffer.String(), "\n")
+	}
+	return fmt.Sprintf("%#v", value)
+}
+
+// recordLine returns the line number of the JSON Lines record containing the element, which is the key of its root.
+func recordLine(v runner.Element) (interface{}, bool) {
+	for v.Parent != nil {
+		v = *v.Parent
+	}
+	return v.Key, v.Key != nil
+}
+
+// queryFile runs the query on the file and writes the results to the output. In the location mode,
+// results are prefixed by their locations, like grep does. Otherwise, they are prefixed
+// by the file name, if there are multiple files, and formatted as log messages.
+// Streamed files (JSON Lines and, with -stream, JSON) have their results written as soon as they are found.
+func queryFile(path string, f format, output io.Writer) error {
+	logger := log.New(output, log.Prefix(), log.Flags())
+	emit := func(v runner.Element) error {
+		resultPath, err := v.FormatPath(pathFormat)
+		if err != nil {
+			return err
+		}
+
+		// Paths of JSON Lines results are relative to their records, which are identified by their line numbers.
+		source := path
+		line, isRecord := recordLine(v)
+		if isRecord {
+			source = fmt.Sprintf("%s:%v", path, line)
+		}
+
+		if locations {
+			location := source
+			if position, ok := v.Position(); ok {
+				location = fmt.Sprintf("%s:%v", path, position)
 			}
+			_, err := fmt.Fprintf(output, "%s: [%s] -- %s\n", location, resultPath, formatValue(v.Value))
+			return err
+		} else if len(inputs) > 1 {
+			return logger.Output(2, fmt.Sprintf("%s: [%s] -- %s\n", source, resultPath, formatValue(v.Value)))
+		} else if isRecord {
+			return logger.Output(2, fmt.Sprintf("%v: [%s] -- %s\n", line, resultPath, formatValue(v.Value)))
+		} else {
+			return logger.Output(2, fmt.Sprintf("[%s] -- %s\n", resultPath, formatValue(v.Value)))
+		}
+	}
+
+	if f.stream != nil && (f.Format == nil || stream) {
+		return f.stream(queryRunner, query, path, emit)
+	}
+
+	root, err := decodeFile(path, f)
+	if err != nil {
+		return err
+	}
+
+	results, err := queryRunner.RunNodes(query, root)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range results {
+		if err := emit(v); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func main() {
+	parseFlags()
+
+	process, output := queryFile, log.Writer()
+	if len(mutations) > 0 {
+		process, output = modifyFile, os.Stdout
+	} else if locations {
+		output = os.Stdout
+	}
+
+	// A single file is processed directly, so that its results are written as soon as they are found.
+	if len(inputs) == 1 {
+		if err := process(inputs[0].path, inputs[0].format, output); err != nil {
+			log.Fatalf("%s: %v\n", inputs[0].path, err)
+		}
+		return
+	}
+
+	// Errors do not stop other files from being processed (and modified files from being written),
+	// the program exits with an error once all of them are done.
+	failed := false
+	processInputs(inputs, jobs, func(in input) (string, error) {
+		buffer := bytes.Buffer{}
+		err := process(in.path, in.format, &buffer)
+		return buffer.String(), err
+	}, func(in input, result string, err error) {
+		if _, writeErr := io.WriteString(output, result); writeErr != nil {
+			log.Println(writeErr)
+			failed = true
+		}
+		if err != nil {
+			log.Printf("%s: %v\n", in.path, err)
+			failed = true
+		}
+	})
 
-	for k, v := range results {
-		log.Printf("[%v] -- %#v\n", k, v.Value)
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/natiiix/uniquery/pkg/runner"
+)
+
+var testTabSplitAssignment = []struct {
+	arg   string
+	query string
+	value string
+}{
+	{`a=1`, `a`, `1`},
+	{`spec.replicas=3`, `spec.replicas`, `3`},
+	{`*.name=web.=api`, `*.name=web.`, `api`},
+	{`name="a=b"`, `name`, `"a=b"`},
+	{`"a=b"=c`, `"a=b"`, `c`},
+	{`a\=b=c`, `a\=b`, `c`},
+	{`a=`, `a`, ``},
+	{`=1`, ``, `1`},
+}
+
+func TestSplitAssignment(t *testing.T) {
+	for _, entry := range testTabSplitAssignment {
+		query, value, err := splitAssignment(entry.arg)
+		if err != nil {
+			t.Errorf("Assignment `%s` returned an error: %v", entry.arg, err)
+		} else if query != entry.query || value != entry.value {
+			t.Errorf("Assignment `%s` was split into `%s` and `%s` instead of `%s` and `%s`", entry.arg, query, value, entry.query, entry.value)
+		}
+	}
+
+	for _, arg := range []string{``, `a`, `"a=b"`, `a\=b`} {
+		if _, _, err := splitAssignment(arg); err == nil {
+			t.Errorf("Assignment `%s` was expected to fail", arg)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uniquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.json")
+	if err := ioutil.WriteFile(path, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(original bool) { backup = original }(backup)
+	backup = true
+
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "new" {
+		t.Errorf("Unexpected content of the file: %q (%v)", data, err)
+	}
+	if data, err := ioutil.ReadFile(path + ".bak"); err != nil || string(data) != "old" {
+		t.Errorf("Unexpected content of the backup: %q (%v)", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("File mode was not kept: %v (%v)", info.Mode(), err)
+	}
+
+	// No temporary files are left behind.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 2 {
+		t.Errorf("Unexpected files in the directory: %v (%v)", files, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing.json"), []byte("new")); err == nil {
+		t.Error("Missing file was written")
+	}
+}
+
+func TestModifyFileInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uniquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "page.json")
+	if err := ioutil.WriteFile(path, []byte(`{"title": "Tom & Jerry", "body": "<p>", "draft": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(originalMutations []mutation, originalInPlace bool, originalRunner *runner.Runner) {
+		mutations, inPlace, queryRunner = originalMutations, originalInPlace, originalRunner
+	}(mutations, inPlace, queryRunner)
+	mutations = []mutation{{query: `draft`, value: `false`}}
+	inPlace = true
+	queryRunner = runner.NewRunner(runner.Options{Indent: 2})
+
+	if err := modifyFile(path, newFormat(runner.JsonFormat), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = "{\n  \"title\": \"Tom & Jerry\",\n  \"body\": \"<p>\",\n  \"draft\": false\n}\n"
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != expected {
+		t.Errorf("Unexpected content of the modified file: %q instead of %q (%v)", data, expected, err)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	if formatted := formatValue(map[string]interface{}{"a": "<b> & c"}); formatted != `{"a":"<b> & c"}` {
+		t.Errorf("Unexpected formatted value: %s", formatted)
+	} else if formatted := formatValue(strings.NewReader); !strings.HasPrefix(formatted, "(func(") {
+		t.Errorf("Unexpected formatted function: %s", formatted)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	queryRunner = runner.NewRunner(runner.Options{})
+
+	results, err := queryRunner.RunJsonString(`id`, `{"id": 9007199254740993}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range results {
+		if formatted := formatValue(e.Value); formatted != `9007199254740993` {
+			t.Errorf("Unexpected formatted number: %s", formatted)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 module github.com/natiiix/uniquery
 
-go 1.12
+go 1.14
 
 require (
 	github.com/google/go-cmp v0.3.1
-	gopkg.in/yaml.v2 v2.2.7
+	gopkg.in/yaml.v3 v3.0.1
 )
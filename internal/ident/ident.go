@@ -0,0 +1,19 @@
+// Package ident checks names of filters, functions and operators. It is shared by the parser
+// and by the packages whose names the parser recognizes, so that it does not depend on either of them.
+package ident
+
+// IsRune returns true if the rune may be part of a name.
+// Names consist of letters, digits and underscores, but they do not begin with a digit.
+func IsRune(r rune, first bool) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (!first && r >= '0' && r <= '9')
+}
+
+// IsValid returns true if the name is a valid name of a filter, a function or an operator.
+func IsValid(name string) bool {
+	for i, r := range name {
+		if !IsRune(r, i == 0) {
+			return false
+		}
+	}
+	return name != ""
+}
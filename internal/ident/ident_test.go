@@ -0,0 +1,23 @@
+package ident
+
+import "testing"
+
+var testTabIsValid = map[string]bool{
+	"upper":     true,
+	"cidr_in":   true,
+	"_private":  true,
+	"semver2":   true,
+	"":          false,
+	"2fa":       false,
+	"with-dash": false,
+	"dot.name":  false,
+	"název":     false,
+}
+
+func TestIsValid(t *testing.T) {
+	for name, expected := range testTabIsValid {
+		if IsValid(name) != expected {
+			t.Errorf("IsValid(%q) returned %v instead of %v", name, !expected, expected)
+		}
+	}
+}
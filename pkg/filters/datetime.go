@@ -0,0 +1,227 @@
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of recognized date and time values. Values without time zone are considered UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	// YAML timestamps (https://yaml.org/type/timestamp.html).
+	"2006-1-2t15:4:5.999999999Z07:00",
+	"2006-1-2t15:4:5.999999999 Z07:00",
+	"2006-1-2 15:4:5.999999999 Z07:00",
+	"2006-1-2 15:4:5.999999999",
+	"2006-1-2",
+	// Common log format.
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+// yamlZoneRegex matches time zones of YAML timestamps whose hours have a single digit or which have no minutes
+// (e.g. `-5` in `2001-12-14 21:59:43.10 -5`), which are not supported by layouts.
+var yamlZoneRegex = regexp.MustCompile(`(:\d\d(?:\.\d*)?)[ \t]*([-+])(\d\d?)(?::(\d\d))?$`)
+
+// normalizeYAMLZone rewrites the time zone of a YAML timestamp to the `-07:00` format.
+func normalizeYAMLZone(value string) string {
+	match := yamlZoneRegex.FindStringSubmatchIndex(value)
+	if match == nil {
+		return value
+	}
+
+	hours, minutes := value[match[6]:match[7]], "00"
+	if len(hours) == 1 {
+		hours = "0" + hours
+	}
+	if match[8] >= 0 {
+		minutes = value[match[8]:match[9]]
+	}
+	return value[:match[3]] + " " + value[match[4]:match[5]] + hours + ":" + minutes
+}
+
+const nowReference = "now"
+
+var durationRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+
+// ParseTime parses a date and time value in any of the recognized formats.
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	if normalized := normalizeYAMLZone(value); normalized != value {
+		return ParseTime(normalized)
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date and time format: %q", value)
+}
+
+// ParseDuration parses a duration such as `7d`, `1w2d` or `36h30m`.
+// In addition to the units supported by time.ParseDuration, days (`d`) and weeks (`w`) are supported.
+func ParseDuration(value string) (time.Duration, error) {
+	rest := strings.TrimSpace(value)
+	if rest == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	total := time.Duration(0)
+	for rest != "" {
+		match := durationRegex.FindStringSubmatch(rest)
+		if match == nil {
+			return 0, fmt.Errorf("invalid duration: %q", value)
+		}
+		rest = rest[len(match[0]):]
+
+		switch match[2] {
+		case "d", "w":
+			count, _ := strconv.ParseFloat(match[1], 64)
+			day := float64(24 * time.Hour)
+			if match[2] == "w" {
+				day *= 7
+			}
+			total += time.Duration(count * day)
+
+		default:
+			d, err := time.ParseDuration(match[0])
+			if err != nil {
+				return 0, err
+			}
+			total += d
+		}
+	}
+
+	return total, nil
+}
+
+// TimeReference is a point in time that values are compared against.
+// It is either an absolute time or the current time (at the moment of comparison), plus an offset.
+type TimeReference struct {
+	Time   time.Time
+	Now    bool
+	Offset time.Duration
+}
+
+// Resolve returns the referenced point in time.
+func (r TimeReference) Resolve() time.Time {
+	base := r.Time
+	if r.Now {
+		base = time.Now()
+	}
+
+	return base.Add(r.Offset)
+}
+
+func parseOffset(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := ParseDuration(value[1:])
+	if err != nil {
+		return 0, err
+	} else if value[0] == '-' {
+		return -d, nil
+	} else if value[0] == '+' {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("invalid duration offset: %q", value)
+}
+
+// ParseTimeReference parses values such as `now`, `now-7d`, `2024-01-01` or `2024-01-01T12:00:00Z+36h`.
+func ParseTimeReference(value string) (TimeReference, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(strings.ToLower(value), nowReference) {
+		offset, err := parseOffset(strings.TrimSpace(value[len(nowReference):]))
+		return TimeReference{Now: true, Offset: offset}, err
+	}
+
+	if t, err := ParseTime(value); err == nil {
+		return TimeReference{Time: t}, nil
+	}
+
+	// Both dates and time zones contain signs, so try every sign as a start of the offset, starting from the end.
+	for i := len(value) - 1; i > 0; i-- {
+		if value[i] != '+' && value[i] != '-' {
+			continue
+		}
+
+		if offset, err := parseOffset(value[i:]); err == nil {
+			if t, err := ParseTime(value[:i]); err == nil {
+				return TimeReference{Time: t, Offset: offset}, nil
+			}
+		}
+	}
+
+	return TimeReference{}, fmt.Errorf("invalid date and time reference: %q", value)
+}
+
+// DateTimeFilter compares date and time values with a reference point in time.
+// String values are parsed in any of the recognized formats, other values never match.
+type DateTimeFilter struct {
+	Operator  string
+	Reference TimeReference
+}
+
+// DateTimeOperators are the comparison operators supported by DateTimeFilter.
+var DateTimeOperators = []string{"<", "<=", ">", ">=", "="}
+
+func (f DateTimeFilter) IsMatch(value interface{}) bool {
+	var t time.Time
+
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+
+	case string:
+		var err error
+		if t, err = ParseTime(v); err != nil {
+			return false
+		}
+
+	default:
+		return false
+	}
+
+	ref := f.Reference.Resolve()
+
+	switch f.Operator {
+	case "<":
+		return t.Before(ref)
+
+	case "<=":
+		return !t.After(ref)
+
+	case ">":
+		return t.After(ref)
+
+	case ">=":
+		return !t.Before(ref)
+
+	case "=":
+		return t.Equal(ref)
+
+	default:
+		return false
+	}
+}
@@ -12,11 +12,12 @@ type EqualityFilter struct {
 func (f EqualityFilter) IsMatch(value interface{}) bool {
 	if valueStr, ok := value.(string); ok {
 		return valueStr == f.Value
-	} else if valueFloat, ok := value.(float64); ok {
-		filterFloat, err := strconv.ParseFloat(f.Value, 64)
-		return err == nil && filterFloat == valueFloat
+	} else if valueBool, ok := value.(bool); ok {
+		return strconv.FormatBool(valueBool) == f.Value
+	} else if cmp, ok := compareNumber(value, f.Value); ok {
+		return cmp == 0
 	}
-	// TODO: Add remaining types (bool, nil).
+	// TODO: Add remaining types (nil).
 
 	return false
 }
@@ -44,3 +45,23 @@ func (f InvertFilter) IsMatch(value interface{}) bool {
 type Filter interface {
 	IsMatch(value interface{}) bool
 }
+
+// MatchesContainers reports whether the filter matches maps and arrays. The second return value is false
+// if the match depends on their content, so that containers must be decoded to check the filter.
+// Containers do not have to be decoded for the other filters (e.g. when a document is streamed).
+func MatchesContainers(f Filter) (bool, bool) {
+	switch t := f.(type) {
+	case EqualityFilter, RegexFilter, DateTimeFilter, NumberFilter, SemverFilter, IPFilter, CIDRFilter:
+		return false, true
+
+	case InvertFilter:
+		matches, known := MatchesContainers(t.InnerFilter)
+		return known && !matches, known
+
+	case predicateFilter:
+		return false, t.scalar
+
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,53 @@
+package filters
+
+import (
+	"regexp"
+	"testing"
+)
+
+// mustCreate creates a filter using the factory without arguments.
+func mustCreate(factory Factory, err error) Filter {
+	if err != nil {
+		panic(err)
+	}
+	filter, err := factory([]string{})
+	if err != nil {
+		panic(err)
+	}
+	return filter
+}
+
+var testTabMatchesContainers = []struct {
+	filter  Filter
+	matches bool
+	known   bool
+}{
+	{EqualityFilter{Value: "a"}, false, true},
+	{RegexFilter{Regex: regexp.MustCompile(`.*`)}, false, true},
+	{InvertFilter{InnerFilter: EqualityFilter{Value: "a"}}, true, true},
+	{InvertFilter{InnerFilter: InvertFilter{InnerFilter: EqualityFilter{Value: "a"}}}, false, true},
+	{IPFilter{Version: AnyIPVersion}, false, true},
+	{NumberFilter{Operator: "<", Value: "5"}, false, true},
+	{SemverFilter{Range: VersionRange{}}, false, true},
+	{mustCreate(newPredicateFactory(func(value string) bool { return len(value) < 3 })), false, true},
+	// Predicates of any value may depend on the content of containers.
+	{mustCreate(newPredicateFactory(func(value interface{}) bool { return value != nil })), false, false},
+	{InvertFilter{InnerFilter: mustCreate(newPredicateFactory(func(value []interface{}) bool { return len(value) > 0 }))}, false, false},
+}
+
+func TestMatchesContainers(t *testing.T) {
+	for _, entry := range testTabMatchesContainers {
+		if matches, known := MatchesContainers(entry.filter); matches != entry.matches || known != entry.known {
+			t.Errorf("Unexpected match of containers by %#v: %t, %t instead of %t, %t", entry.filter, matches, known, entry.matches, entry.known)
+		}
+
+		// Known results are the same as the results of the filter itself.
+		if _, known := MatchesContainers(entry.filter); known {
+			for _, container := range []interface{}{map[string]interface{}{"a": "a"}, []interface{}{"a"}} {
+				if entry.filter.IsMatch(container) != entry.matches {
+					t.Errorf("Filter %#v does not match %v as reported", entry.filter, container)
+				}
+			}
+		}
+	}
+}
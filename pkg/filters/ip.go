@@ -0,0 +1,122 @@
+package filters
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IP versions accepted by IPFilter.
+const (
+	AnyIPVersion = 0
+	IPv4         = 4
+	IPv6         = 6
+)
+
+// parseIPValue parses an IP address or a CIDR network (`10.1.0.0/16`) and returns its IP version.
+// A single address is returned as a network with the full-length prefix.
+func parseIPValue(value interface{}) (*net.IPNet, int, bool) {
+	valueStr, ok := value.(string)
+	if !ok {
+		return nil, 0, false
+	}
+
+	valueStr = strings.TrimSpace(valueStr)
+	version := IPv6
+	if isIPv4(valueStr) {
+		version = IPv4
+	}
+
+	if strings.ContainsRune(valueStr, '/') {
+		ip, network, err := net.ParseCIDR(valueStr)
+		if err != nil {
+			return nil, 0, false
+		}
+		network.IP = ip
+		return network, version, true
+	}
+
+	ip := net.ParseIP(valueStr)
+	if ip == nil {
+		return nil, 0, false
+	}
+
+	bits := 8 * net.IPv6len
+	if version == IPv4 {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, version, true
+}
+
+// isIPv4 checks the notation of the address, because IPv4-mapped IPv6 addresses (`::ffff:1.2.3.4`) have an IPv4 form too.
+func isIPv4(address string) bool {
+	return !strings.ContainsRune(address, ':')
+}
+
+// IPFilter matches valid IP addresses (and CIDR networks) of the specified version.
+type IPFilter struct {
+	Version int
+}
+
+func (f IPFilter) IsMatch(value interface{}) bool {
+	_, version, ok := parseIPValue(value)
+	return ok && (f.Version == AnyIPVersion || f.Version == version)
+}
+
+// CIDRFilter matches IP addresses (and CIDR networks) contained in any of the networks.
+type CIDRFilter struct {
+	Networks []*net.IPNet
+}
+
+func (f CIDRFilter) IsMatch(value interface{}) bool {
+	valueNetwork, _, ok := parseIPValue(value)
+	if !ok {
+		return false
+	}
+
+	valueOnes, valueBits := valueNetwork.Mask.Size()
+
+	for _, network := range f.Networks {
+		ones, bits := network.Mask.Size()
+		valueIP := valueNetwork.IP
+		if bits == 8*net.IPv4len {
+			valueIP = valueIP.To4()
+		}
+
+		// The value network must be the same size or smaller than the filter network.
+		if valueIP != nil && network.Contains(valueIP) && (valueBits-valueOnes) <= (bits-ones) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newIPFilter(version int) Factory {
+	return func(args []string) (Filter, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("expected no arguments, got %d", len(args))
+		}
+
+		return IPFilter{Version: version}, nil
+	}
+}
+
+func newCIDRFilter(args []string) (Filter, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected at least 1 argument")
+	}
+
+	filter := CIDRFilter{}
+	for _, arg := range args {
+		_, network, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, err
+		}
+		filter.Networks = append(filter.Networks, network)
+	}
+
+	return filter, nil
+}
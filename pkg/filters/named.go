@@ -0,0 +1,134 @@
+package filters
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/natiiix/uniquery/internal/ident"
+	"github.com/natiiix/uniquery/pkg/typed"
+)
+
+// Factory creates a named filter from its (already unquoted) arguments.
+type Factory func(args []string) (Filter, error)
+
+var (
+	namedFiltersMutex sync.RWMutex
+	namedFilters      map[string]Factory
+)
+
+func init() {
+	namedFilters = map[string]Factory{
+		"semver":  newSemverFilter,
+		"ip":      newIPFilter(AnyIPVersion),
+		"ipv4":    newIPFilter(IPv4),
+		"ipv6":    newIPFilter(IPv6),
+		"cidr_in": newCIDRFilter,
+		"lt":      newNumberFilter("<"),
+		"le":      newNumberFilter("<="),
+		"gt":      newNumberFilter(">"),
+		"ge":      newNumberFilter(">="),
+	}
+}
+
+// Register adds a named filter, which can then be used in queries as `@name` or `@name(arguments)`.
+// Filters are created when queries are compiled, so invalid arguments are reported as parse errors.
+// It panics if the name is not an identifier or if a filter of the same name is already registered.
+func Register(name string, factory Factory) {
+	if !ident.IsValid(name) {
+		panic("filters: invalid filter name: " + name)
+	}
+
+	namedFiltersMutex.Lock()
+	defer namedFiltersMutex.Unlock()
+
+	if _, exists := namedFilters[name]; exists {
+		panic("filters: filter @" + name + " is already registered")
+	}
+	namedFilters[name] = factory
+}
+
+// RegisterPredicate adds a named filter implemented by a Go function returning bool, such as
+// `func(value string, allowed ...string) bool`. The first parameter receives the filtered value and the others
+// receive the arguments, converted to their types (see package typed). Values which cannot be converted
+// to the type of the first parameter do not match. It panics if the predicate cannot be used as a filter.
+func RegisterPredicate(name string, predicate interface{}) {
+	factory, err := newPredicateFactory(predicate)
+	if err != nil {
+		panic("filters: " + err.Error())
+	}
+	Register(name, factory)
+}
+
+// newPredicateFactory creates the factory of filters implemented by the predicate (see RegisterPredicate).
+func newPredicateFactory(predicate interface{}) (Factory, error) {
+	fn, err := typed.New(predicate)
+	if err != nil {
+		return nil, err
+	} else if fnType := fn.Type(); fnType.NumOut() != 1 || fnType.Out(0).Kind() != reflect.Bool {
+		return nil, fmt.Errorf("predicate %s must return bool", fnType)
+	}
+
+	return func(args []string) (Filter, error) {
+		call, err := fn.Bind(args)
+		if err != nil {
+			return nil, err
+		}
+		return predicateFilter{call: call, scalar: isScalarKind(fn.ValueType().Kind())}, nil
+	}, nil
+}
+
+// predicateFilter matches values for which the predicate returns true.
+type predicateFilter struct {
+	call func(value interface{}) ([]reflect.Value, bool)
+	// scalar is set if the value parameter cannot receive maps and arrays, so the predicate never matches them.
+	scalar bool
+}
+
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func (f predicateFilter) IsMatch(value interface{}) bool {
+	results, ok := f.call(value)
+	return ok && results[0].Bool()
+}
+
+// NewNamed creates the named filter (such as `@semver(^1.2)`) with the specified (already unquoted) arguments.
+func NewNamed(name string, args []string) (Filter, error) {
+	namedFiltersMutex.RLock()
+	factory, exists := namedFilters[name]
+	namedFiltersMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown filter: @%s", name)
+	}
+
+	filter, err := factory(args)
+	if err != nil {
+		return nil, fmt.Errorf("@%s: %v", name, err)
+	}
+
+	return filter, nil
+}
+
+func newSemverFilter(args []string) (Filter, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	r, err := ParseVersionRange(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return SemverFilter{Range: r}, nil
+}
@@ -0,0 +1,99 @@
+package filters
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// ToRat converts an exactly represented number (integers and json.Number) to a rational number.
+// Float values are not converted, because their binary representation rarely equals the decimal literal.
+func ToRat(value interface{}) (*big.Rat, bool) {
+	switch t := value.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(t))
+
+	case int:
+		return new(big.Rat).SetInt64(int64(t)), true
+
+	case int64:
+		return new(big.Rat).SetInt64(t), true
+
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(t)), true
+
+	default:
+		return nil, false
+	}
+}
+
+// compareNumber compares the value with the number literal. The second return value is false
+// if the value is not a number or the literal is invalid.
+func compareNumber(value interface{}, literal string) (int, bool) {
+	if valueFloat, ok := value.(float64); ok {
+		literalFloat, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return 0, false
+		} else if valueFloat < literalFloat {
+			return -1, true
+		} else if valueFloat > literalFloat {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	valueRat, ok := ToRat(value)
+	if !ok {
+		return 0, false
+	}
+
+	literalRat, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		return 0, false
+	}
+
+	return valueRat.Cmp(literalRat), true
+}
+
+// NumberFilter compares numbers with a number literal without loss of precision (except for float values).
+type NumberFilter struct {
+	Operator string
+	Value    string
+}
+
+func (f NumberFilter) IsMatch(value interface{}) bool {
+	cmp, ok := compareNumber(value, f.Value)
+	if !ok {
+		return false
+	}
+
+	switch f.Operator {
+	case "<":
+		return cmp < 0
+
+	case "<=":
+		return cmp <= 0
+
+	case ">":
+		return cmp > 0
+
+	case ">=":
+		return cmp >= 0
+
+	default:
+		return cmp == 0
+	}
+}
+
+func newNumberFilter(operator string) Factory {
+	return func(args []string) (Filter, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+		} else if _, ok := new(big.Rat).SetString(args[0]); !ok {
+			return nil, fmt.Errorf("invalid number: %q", args[0])
+		}
+
+		return NumberFilter{Operator: operator, Value: args[0]}, nil
+	}
+}
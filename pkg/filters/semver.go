@@ -0,0 +1,347 @@
+package filters
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (https://semver.org/). Build metadata is ignored.
+type Version struct {
+	Major      int64
+	Minor      int64
+	Patch      int64
+	Prerelease []string
+}
+
+// partialVersion is a version with some of its components possibly missing (`1.2`, `1.x`, `*`).
+type partialVersion struct {
+	Version
+	// Number of specified numeric components (0 to 3).
+	Specified int
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+func parsePartialVersion(s string) (partialVersion, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "=")
+
+	if i := strings.IndexRune(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	pv := partialVersion{}
+	if i := strings.IndexRune(s, '-'); i >= 0 {
+		pv.Prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	if s == "" {
+		return pv, fmt.Errorf("empty version")
+	}
+
+	components := strings.Split(s, ".")
+	if len(components) > 3 {
+		return pv, fmt.Errorf("invalid version: %q", s)
+	}
+
+	numbers := []*int64{&pv.Major, &pv.Minor, &pv.Patch}
+	for i, component := range components {
+		if isWildcard(component) {
+			break
+		}
+
+		n, err := strconv.ParseInt(component, 10, 64)
+		if err != nil || n < 0 {
+			return pv, fmt.Errorf("invalid version component %q in %q", component, s)
+		}
+
+		*numbers[i] = n
+		pv.Specified++
+	}
+
+	return pv, nil
+}
+
+// ParseVersion parses a version value. A leading `v` and range operators (as in `^1.2.3` or `>=1.2`)
+// are ignored, so that declared dependency versions are compared by their base version.
+// Missing components are considered zero.
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimLeft(strings.TrimSpace(s), "^~=<> v")
+
+	pv, err := parsePartialVersion(s)
+	if err != nil {
+		return Version{}, err
+	} else if pv.Specified == 0 {
+		return Version{}, fmt.Errorf("invalid version: %q", s)
+	}
+
+	return pv.Version, nil
+}
+
+func comparePrereleaseIdentifiers(a string, b string) int {
+	aNum, aErr := strconv.ParseInt(a, 10, 64)
+	bNum, bErr := strconv.ParseInt(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(aNum, bNum)
+
+	// Numeric identifiers always have lower precedence than alphanumeric ones.
+	case aErr == nil:
+		return -1
+
+	case bErr == nil:
+		return 1
+
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareInts(a int64, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+// Compare returns -1, 0 or 1 depending on whether v has lower, equal or higher precedence than other.
+func (v Version) Compare(other Version) int {
+	if c := compareInts(v.Major, other.Major); c != 0 {
+		return c
+	} else if c := compareInts(v.Minor, other.Minor); c != 0 {
+		return c
+	} else if c := compareInts(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	// A version without prerelease has higher precedence than the same version with prerelease.
+	if len(v.Prerelease) == 0 || len(other.Prerelease) == 0 {
+		return -compareInts(int64(len(v.Prerelease)), int64(len(other.Prerelease)))
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareInts(int64(len(v.Prerelease)), int64(len(other.Prerelease)))
+}
+
+type versionComparator struct {
+	Operator string
+	Version  Version
+}
+
+func (c versionComparator) isMatch(v Version) bool {
+	cmp := v.Compare(c.Version)
+
+	switch c.Operator {
+	case "<":
+		return cmp < 0
+
+	case "<=":
+		return cmp <= 0
+
+	case ">":
+		return cmp > 0
+
+	case ">=":
+		return cmp >= 0
+
+	default:
+		return cmp == 0
+	}
+}
+
+// bump returns the lowest version above all versions matching the partial version.
+func (pv partialVersion) bump() Version {
+	switch pv.Specified {
+	case 1:
+		return Version{Major: pv.Major + 1}
+
+	case 2:
+		return Version{Major: pv.Major, Minor: pv.Minor + 1}
+
+	default:
+		return Version{Major: pv.Major, Minor: pv.Minor, Patch: pv.Patch + 1}
+	}
+}
+
+// expandComparator converts a single range comparator (`^1.2`, `~1.2.3`, `<=2`, `1.x`, ...) into primitive comparators.
+func expandComparator(s string) ([]versionComparator, error) {
+	op := ""
+	for _, prefix := range []string{"<=", ">=", "<", ">", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	pv, err := parsePartialVersion(s[len(op):])
+	if err != nil {
+		return nil, err
+	}
+
+	// Wildcard matches any version.
+	if pv.Specified == 0 {
+		return []versionComparator{}, nil
+	}
+
+	lower := versionComparator{">=", pv.Version}
+
+	switch op {
+	case "<":
+		return []versionComparator{{"<", pv.Version}}, nil
+
+	case ">=":
+		return []versionComparator{lower}, nil
+
+	case "<=":
+		if pv.Specified < 3 {
+			return []versionComparator{{"<", pv.bump()}}, nil
+		}
+		return []versionComparator{{"<=", pv.Version}}, nil
+
+	case ">":
+		if pv.Specified < 3 {
+			return []versionComparator{{">=", pv.bump()}}, nil
+		}
+		return []versionComparator{{">", pv.Version}}, nil
+
+	case "~":
+		if pv.Specified == 3 {
+			pv.Specified = 2
+		}
+		return []versionComparator{lower, {"<", pv.bump()}}, nil
+
+	case "^":
+		// Caret allows changes that do not modify the left-most non-zero component.
+		if pv.Major > 0 || pv.Specified == 1 {
+			pv.Specified = 1
+		} else if pv.Minor > 0 || pv.Specified == 2 {
+			pv.Specified = 2
+		}
+		return []versionComparator{lower, {"<", pv.bump()}}, nil
+
+	default:
+		if pv.Specified < 3 {
+			return []versionComparator{lower, {"<", pv.bump()}}, nil
+		}
+		return []versionComparator{{"=", pv.Version}}, nil
+	}
+}
+
+// VersionRange is a disjunction of comparator sets. A version matches if it matches all comparators of any set.
+type VersionRange [][]versionComparator
+
+// ParseVersionRange parses a range in the npm syntax, such as `>=1.2.0 <2.0.0`, `^1.2 || ~2.3.4` or `1.0 - 1.5`.
+func ParseVersionRange(s string) (VersionRange, error) {
+	r := VersionRange{}
+
+	for _, alternative := range strings.Split(s, "||") {
+		fields := strings.Fields(alternative)
+
+		// Remove spaces between operators and versions (`>= 1.2.3`).
+		for i := 0; i < len(fields)-1; i++ {
+			if strings.Trim(fields[i], "<>=^~") == "" {
+				fields[i] += fields[i+1]
+				fields = append(fields[:i+1], fields[i+2:]...)
+			}
+		}
+
+		// Hyphen range (`1.2.3 - 2.3.4`).
+		if len(fields) == 3 && fields[1] == "-" {
+			fields = []string{">=" + fields[0], "<=" + fields[2]}
+		}
+
+		if len(fields) == 0 {
+			fields = []string{"*"}
+		}
+
+		set := []versionComparator{}
+		for _, field := range fields {
+			comparators, err := expandComparator(field)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, comparators...)
+		}
+
+		r = append(r, set)
+	}
+
+	return r, nil
+}
+
+// IsMatch checks whether the version satisfies the range. As in npm, prerelease versions satisfy a comparator set
+// only if one of its comparators has a prerelease version with the same major, minor and patch numbers,
+// so `<1.0.0` does not match `1.0.0-rc.1`, but `>=1.0.0-rc.0 <1.0.0` does.
+func (r VersionRange) IsMatch(v Version) bool {
+	for _, set := range r {
+		matches := true
+		for _, c := range set {
+			if !c.isMatch(v) {
+				matches = false
+				break
+			}
+		}
+
+		if matches && (len(v.Prerelease) == 0 || allowsPrerelease(set, v)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowsPrerelease(set []versionComparator, v Version) bool {
+	for _, c := range set {
+		if len(c.Version.Prerelease) > 0 && c.Version.Major == v.Major && c.Version.Minor == v.Minor && c.Version.Patch == v.Patch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SemverFilter matches version strings which satisfy a version range.
+// Numbers are matched too, because versions such as `1.5` are often not quoted in YAML and JSON data.
+// Numbers decoded as float64 have lost their trailing zeros, so `1.10` is matched as `1.1`.
+// JSON numbers (json.Number) keep their literal and are matched exactly.
+type SemverFilter struct {
+	Range VersionRange
+}
+
+func (f SemverFilter) IsMatch(value interface{}) bool {
+	var valueStr string
+
+	switch v := value.(type) {
+	case string:
+		valueStr = v
+
+	case float64:
+		valueStr = strconv.FormatFloat(v, 'f', -1, 64)
+
+	case int:
+		valueStr = strconv.Itoa(v)
+
+	case json.Number:
+		valueStr = string(v)
+
+	default:
+		return false
+	}
+
+	version, err := ParseVersion(valueStr)
+	return err == nil && f.Range.IsMatch(version)
+}
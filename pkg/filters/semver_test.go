@@ -0,0 +1,98 @@
+package filters
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testTabVersionRange = []struct {
+	versionRange string
+	version      string
+	matches      bool
+}{
+	{`1.2.3`, `1.2.3`, true},
+	{`1.2.3`, `v1.2.3`, true},
+	{`1.2.3`, `1.2.4`, false},
+	{`1.2`, `1.2.9`, true},
+	{`1.2`, `1.3.0`, false},
+	{`1.x`, `1.9.0`, true},
+	{`*`, `0.0.1`, true},
+	{`>=1.2.0 <2.0.0`, `1.10.0`, true},
+	{`>=1.2.0 <2.0.0`, `1.9.0`, true},
+	{`>=1.2.0 <2.0.0`, `2.0.0`, false},
+	{`>=1.10.0`, `1.9.0`, false},
+	{`>= 1.10.0`, `1.10.0`, true},
+	{`<3`, `2.99.99`, true},
+	{`<3`, `3.0.0`, false},
+	{`<=3`, `3.5.0`, true},
+	{`>3`, `3.5.0`, false},
+	{`>3`, `4.0.0`, true},
+	{`~1.2.3`, `1.2.9`, true},
+	{`~1.2.3`, `1.3.0`, false},
+	{`^1.2.3`, `1.9.0`, true},
+	{`^1.2.3`, `2.0.0`, false},
+	{`^0.2.3`, `0.2.9`, true},
+	{`^0.2.3`, `0.3.0`, false},
+	{`^0.0.3`, `0.0.4`, false},
+	{`1.0 - 1.5`, `1.5.9`, true},
+	{`1.0 - 1.5.0`, `1.5.1`, false},
+	{`^1 || ^3`, `3.1.0`, true},
+	{`^1 || ^3`, `2.1.0`, false},
+	{`<1.0.0`, `1.0.0-rc.1`, false},
+	{`^1`, `2.0.0-rc.1`, false},
+	{`^1.2`, `1.3.0-beta`, false},
+	{`>=1.0.0-rc.0 <1.0.0`, `1.0.0-rc.1`, true},
+	{`^1.2.3-beta.2`, `1.2.3-beta.4`, true},
+	{`^1.2.3-beta.2`, `1.2.4-beta.4`, false},
+	{`*`, `1.0.0-rc.1`, false},
+	{`>1.0.0-alpha`, `1.0.1-alpha`, false},
+	{`>1.0.0-alpha`, `1.0.0-alpha.1`, true},
+	{`>1.0.0-alpha.2`, `1.0.0-alpha.10`, true},
+	{`>1.0.0-beta`, `1.0.0-alpha.10`, false},
+	{`1.2.3`, `1.2.3+build.5`, true},
+	{`^1.2`, `^1.4.0`, true},
+	{`^1.2`, `not a version`, false},
+}
+
+func TestVersionRange(t *testing.T) {
+	for _, entry := range testTabVersionRange {
+		r, err := ParseVersionRange(entry.versionRange)
+		if err != nil {
+			t.Errorf("Unable to parse range `%s`: %v", entry.versionRange, err)
+			continue
+		}
+
+		if (SemverFilter{Range: r}).IsMatch(entry.version) != entry.matches {
+			t.Errorf("Version `%s` was expected to match range `%s`: %t", entry.version, entry.versionRange, entry.matches)
+		}
+	}
+}
+
+var testTabVersionNumbers = []struct {
+	versionRange string
+	version      interface{}
+	matches      bool
+}{
+	{`1.5`, 1.5, true},
+	{`2`, 2, true},
+	{`>=1.9`, json.Number("1.10"), true},
+	{`1.10`, json.Number("1.10"), true},
+	// Trailing zeros of float64 values are lost.
+	{`1.10`, 1.10, false},
+	{`1.1`, 1.10, true},
+	{`1.x`, true, false},
+}
+
+func TestVersionNumbers(t *testing.T) {
+	for _, entry := range testTabVersionNumbers {
+		r, err := ParseVersionRange(entry.versionRange)
+		if err != nil {
+			t.Errorf("Unable to parse range `%s`: %v", entry.versionRange, err)
+			continue
+		}
+
+		if (SemverFilter{Range: r}).IsMatch(entry.version) != entry.matches {
+			t.Errorf("Version %#v was expected to match range `%s`: %t", entry.version, entry.versionRange, entry.matches)
+		}
+	}
+}
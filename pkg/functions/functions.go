@@ -0,0 +1,279 @@
+package functions
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/natiiix/uniquery/internal/ident"
+	"github.com/natiiix/uniquery/pkg/typed"
+)
+
+// Function transforms a single value.
+type Function func(value interface{}) (interface{}, error)
+
+// Factory creates a function from its (already unquoted) arguments.
+type Factory func(args []string) (Function, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      map[string]Factory
+)
+
+func init() {
+	factories = map[string]Factory{
+		"lower":         stringFunction("lower", strings.ToLower),
+		"upper":         stringFunction("upper", strings.ToUpper),
+		"trim":          stringFunction("trim", strings.TrimSpace),
+		"split":         newSplit,
+		"join":          newJoin,
+		"replace":       newReplace,
+		"substr":        newSubstr,
+		"regex_capture": newRegexCapture,
+	}
+}
+
+// Register adds a function, which can then be used in pipelines as `name()` or `name(arguments)`.
+// Functions are created when queries are compiled, so invalid arguments are reported as parse errors.
+// It panics if the name is not an identifier or if a function of the same name is already registered.
+func Register(name string, factory Factory) {
+	if !ident.IsValid(name) {
+		panic("functions: invalid function name: " + name)
+	}
+
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if _, exists := factories[name]; exists {
+		panic("functions: function " + name + " is already registered")
+	}
+	factories[name] = factory
+}
+
+// RegisterFunc adds a function implemented by a Go function returning the transformed value and optionally an error,
+// such as `func(value string, length int) string`. The first parameter receives the transformed value and the others
+// receive the arguments, converted to their types (see package typed). Values which cannot be converted
+// to the type of the first parameter result in a TypeError. It panics if fn cannot be used as a function.
+func RegisterFunc(name string, fn interface{}) {
+	typedFn, err := typed.New(fn)
+	if err != nil {
+		panic("functions: " + err.Error())
+	}
+
+	fnType := typedFn.Type()
+	if fnType.NumOut() < 1 || fnType.NumOut() > 2 || (fnType.NumOut() == 2 && fnType.Out(1) != errorType) {
+		panic(fmt.Sprintf("functions: function %s must return a value and optionally an error", fnType))
+	}
+
+	expected := typedFn.ValueType().String()
+	switch typedFn.ValueType().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		expected = "number"
+	}
+
+	Register(name, func(args []string) (Function, error) {
+		call, err := typedFn.Bind(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(value interface{}) (interface{}, error) {
+			results, ok := call(value)
+			if !ok {
+				return nil, TypeError{Function: name, Expected: expected, Value: value}
+			} else if len(results) == 2 && !results[1].IsNil() {
+				return nil, results[1].Interface().(error)
+			}
+			return results[0].Interface(), nil
+		}, nil
+	})
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// New creates the function with the specified name.
+// The second return value is false if there is no such function.
+func New(name string, args []string) (Function, bool, error) {
+	factoriesMutex.RLock()
+	factory, exists := factories[name]
+	factoriesMutex.RUnlock()
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	fn, err := factory(args)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return fn, true, nil
+}
+
+type TypeError struct {
+	Function string
+	Expected string
+	Value    interface{}
+}
+
+func (e TypeError) Error() string {
+	return fmt.Sprintf("%s: expected %s, got %T", e.Function, e.Expected, e.Value)
+}
+
+func checkArgs(args []string, min int, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("expected %d arguments, got %d", min, len(args))
+		}
+		return fmt.Errorf("expected %d to %d arguments, got %d", min, max, len(args))
+	}
+
+	return nil
+}
+
+func stringFunction(name string, transform func(string) string) Factory {
+	return func(args []string) (Function, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+
+		return func(value interface{}) (interface{}, error) {
+			if valueStr, ok := value.(string); ok {
+				return transform(valueStr), nil
+			}
+
+			return nil, TypeError{Function: name, Expected: "string", Value: value}
+		}, nil
+	}
+}
+
+func newSplit(args []string) (Function, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	return func(value interface{}) (interface{}, error) {
+		valueStr, ok := value.(string)
+		if !ok {
+			return nil, TypeError{Function: "split", Expected: "string", Value: value}
+		}
+
+		parts := []interface{}{}
+		for _, part := range strings.Split(valueStr, args[0]) {
+			parts = append(parts, part)
+		}
+		return parts, nil
+	}, nil
+}
+
+func newJoin(args []string) (Function, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	return func(value interface{}) (interface{}, error) {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, TypeError{Function: "join", Expected: "array of strings", Value: value}
+		}
+
+		parts := make([]string, len(items))
+		for i, item := range items {
+			if parts[i], ok = item.(string); !ok {
+				return nil, TypeError{Function: "join", Expected: "array of strings", Value: item}
+			}
+		}
+		return strings.Join(parts, args[0]), nil
+	}, nil
+}
+
+func newReplace(args []string) (Function, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	return func(value interface{}) (interface{}, error) {
+		if valueStr, ok := value.(string); ok {
+			return strings.Replace(valueStr, args[0], args[1], -1), nil
+		}
+
+		return nil, TypeError{Function: "replace", Expected: "string", Value: value}
+	}, nil
+}
+
+func newSubstr(args []string) (Function, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	bounds := []int{}
+	for _, arg := range args {
+		bound, err := strconv.Atoi(arg)
+		if err != nil || bound < 0 {
+			return nil, fmt.Errorf("invalid index: %q", arg)
+		}
+		bounds = append(bounds, bound)
+	}
+
+	return func(value interface{}) (interface{}, error) {
+		valueStr, ok := value.(string)
+		if !ok {
+			return nil, TypeError{Function: "substr", Expected: "string", Value: value}
+		}
+
+		// Indices are in runes, not bytes. Out-of-range indices are clamped to the string length.
+		runes := []rune(valueStr)
+		start, end := bounds[0], utf8.RuneCountInString(valueStr)
+		if len(bounds) > 1 && bounds[1] < end {
+			end = bounds[1]
+		}
+		if start > end {
+			start = end
+		}
+		return string(runes[start:end]), nil
+	}, nil
+}
+
+func newRegexCapture(args []string) (Function, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	regex, err := regexp.Compile(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(value interface{}) (interface{}, error) {
+		valueStr, ok := value.(string)
+		if !ok {
+			return nil, TypeError{Function: "regex_capture", Expected: "string", Value: value}
+		}
+
+		match := regex.FindStringSubmatch(valueStr)
+		switch {
+		case match == nil:
+			return nil, nil
+
+		case len(match) == 1:
+			// No capture groups, return the whole match.
+			return match[0], nil
+
+		case len(match) == 2:
+			return match[1], nil
+
+		default:
+			groups := []interface{}{}
+			for _, group := range match[1:] {
+				groups = append(groups, group)
+			}
+			return groups, nil
+		}
+	}, nil
+}
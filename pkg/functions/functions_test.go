@@ -0,0 +1,105 @@
+package functions
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testTabFunctions = []struct {
+	name     string
+	args     []string
+	value    interface{}
+	expected interface{}
+}{
+	{"lower", nil, "Hello World", "hello world"},
+	{"upper", nil, "Hello World", "HELLO WORLD"},
+	{"trim", nil, " \tHello World\n", "Hello World"},
+	{"split", []string{","}, "a,b,,c", []interface{}{"a", "b", "", "c"}},
+	{"split", []string{","}, "", []interface{}{""}},
+	{"join", []string{", "}, []interface{}{"a", "b", "c"}, "a, b, c"},
+	{"join", []string{", "}, []interface{}{}, ""},
+	{"replace", []string{"o", "0"}, "foo boo", "f00 b00"},
+	{"substr", []string{"1"}, "héllo", "éllo"},
+	{"substr", []string{"1", "3"}, "héllo", "él"},
+	{"substr", []string{"3", "100"}, "héllo", "lo"},
+	{"substr", []string{"10"}, "héllo", ""},
+	{"regex_capture", []string{`\d+`}, "abc 123 def", "123"},
+	{"regex_capture", []string{`v(\d+)`}, "v42", "42"},
+	{"regex_capture", []string{`(\d+)\.(\d+)`}, "1.25", []interface{}{"1", "25"}},
+	{"regex_capture", []string{`\d+`}, "abc", nil},
+}
+
+func TestFunctions(t *testing.T) {
+	for _, entry := range testTabFunctions {
+		fn, exists, err := New(entry.name, entry.args)
+		if !exists || err != nil {
+			t.Errorf("Function %s%q cannot be created: %t, %v", entry.name, entry.args, exists, err)
+			continue
+		}
+
+		if actual, err := fn(entry.value); err != nil {
+			t.Errorf("Function %s%q returned an error for %#v: %v", entry.name, entry.args, entry.value, err)
+		} else if !cmp.Equal(actual, entry.expected) {
+			t.Errorf("Function %s%q returned %#v for %#v instead of %#v", entry.name, entry.args, actual, entry.value, entry.expected)
+		}
+	}
+}
+
+var testTabTypeErrors = []struct {
+	name  string
+	args  []string
+	value interface{}
+	err   TypeError
+}{
+	{"lower", nil, 1.0, TypeError{"lower", "string", 1.0}},
+	{"upper", nil, nil, TypeError{"upper", "string", nil}},
+	{"trim", nil, true, TypeError{"trim", "string", true}},
+	{"split", []string{","}, []interface{}{"a"}, TypeError{"split", "string", []interface{}{"a"}}},
+	{"join", []string{","}, "a,b", TypeError{"join", "array of strings", "a,b"}},
+	{"join", []string{","}, []interface{}{"a", 1.0}, TypeError{"join", "array of strings", 1.0}},
+	{"replace", []string{"a", "b"}, map[string]interface{}{}, TypeError{"replace", "string", map[string]interface{}{}}},
+	{"substr", []string{"1"}, 12.0, TypeError{"substr", "string", 12.0}},
+	{"regex_capture", []string{"a"}, false, TypeError{"regex_capture", "string", false}},
+}
+
+func TestTypeErrors(t *testing.T) {
+	for _, entry := range testTabTypeErrors {
+		fn, _, err := New(entry.name, entry.args)
+		if err != nil {
+			t.Errorf("Function %s%q cannot be created: %v", entry.name, entry.args, err)
+			continue
+		}
+
+		if actual, err := fn(entry.value); !cmp.Equal(err, error(entry.err)) {
+			t.Errorf("Function %s%q returned %#v, %v for %#v instead of %v", entry.name, entry.args, actual, err, entry.value, entry.err)
+		}
+	}
+}
+
+var testTabInvalidArgs = []struct {
+	name string
+	args []string
+}{
+	{"lower", []string{"x"}},
+	{"split", nil},
+	{"join", []string{",", ","}},
+	{"replace", []string{"a"}},
+	{"substr", nil},
+	{"substr", []string{"x"}},
+	{"substr", []string{"-1"}},
+	{"substr", []string{"1", "2", "3"}},
+	{"regex_capture", []string{"("}},
+}
+
+func TestInvalidArgs(t *testing.T) {
+	for _, entry := range testTabInvalidArgs {
+		if _, exists, err := New(entry.name, entry.args); !exists || err == nil {
+			t.Errorf("Function %s%q was created with invalid arguments", entry.name, entry.args)
+		}
+	}
+
+	if _, exists, err := New("unknown", nil); exists || err != nil {
+		t.Errorf("Unknown function exists: %t, %v", exists, err)
+	}
+}
@@ -0,0 +1,123 @@
+package ordered
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Map is a string-keyed map, which remembers the order in which its keys have been inserted.
+// It is used for JSON objects, so that their keys keep the document order.
+type Map struct {
+	keys   []string
+	values map[string]interface{}
+	// indices are the positions of the keys, so that results can be sorted without searching for their keys.
+	indices map[string]int
+}
+
+func NewMap() *Map {
+	return &Map{keys: []string{}, values: map[string]interface{}{}, indices: map[string]int{}}
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (m *Map) Keys() []string {
+	return append([]string{}, m.keys...)
+}
+
+func (m *Map) Get(key string) (interface{}, bool) {
+	value, exists := m.values[key]
+	return value, exists
+}
+
+// Set stores the value. New keys are added at the end, existing keys keep their position.
+func (m *Map) Set(key string, value interface{}) {
+	if _, exists := m.values[key]; !exists {
+		m.indices[key] = len(m.keys)
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *Map) Delete(key string) {
+	if _, exists := m.values[key]; !exists {
+		return
+	}
+
+	i := m.indices[key]
+	delete(m.values, key)
+	delete(m.indices, key)
+	m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	for ; i < len(m.keys); i++ {
+		m.indices[m.keys[i]] = i
+	}
+}
+
+// IndexOf returns the position of the key, or -1 if the map does not contain it.
+func (m *Map) IndexOf(key string) int {
+	if i, exists := m.indices[key]; exists {
+		return i
+	}
+	return -1
+}
+
+// ToMap returns the entries as a regular (unordered) map. Values are not converted.
+func (m *Map) ToMap() map[string]interface{} {
+	result := make(map[string]interface{}, len(m.values))
+	for k, v := range m.values {
+		result[k] = v
+	}
+	return result
+}
+
+func (m *Map) MarshalJSON() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteRune('{')
+
+	for i, key := range m.keys {
+		if i > 0 {
+			buffer.WriteRune(',')
+		}
+
+		keyJSON, err := marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueJSON, err := marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(keyJSON)
+		buffer.WriteRune(':')
+		buffer.Write(valueJSON)
+	}
+
+	buffer.WriteRune('}')
+	return buffer.Bytes(), nil
+}
+
+// marshal encodes the value without escaping HTML characters. Encoders which escape them
+// (such as json.Marshal) still escape them in the output of MarshalJSON.
+func marshal(value interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte{'\n'}), nil
+}
+
+// GoString formats the map similarly to a map literal, with the keys in order.
+func (m *Map) GoString() string {
+	entries := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		entries[i] = fmt.Sprintf("%#v:%#v", key, m.values[key])
+	}
+	return "ordered.Map{" + strings.Join(entries, ", ") + "}"
+}
@@ -0,0 +1,39 @@
+package ordered
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMap(t *testing.T) {
+	m := NewMap()
+	for i, key := range []string{"z", "a", "m", "b"} {
+		m.Set(key, i)
+	}
+	m.Set("a", "changed")
+	m.Delete("m")
+	m.Delete("missing")
+
+	if keys := m.Keys(); !cmp.Equal(keys, []string{"z", "a", "b"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	for key, index := range map[string]int{"z": 0, "a": 1, "b": 2, "m": -1, "missing": -1} {
+		if i := m.IndexOf(key); i != index {
+			t.Errorf("Unexpected index of %s: %d instead of %d", key, i, index)
+		}
+	}
+
+	if value, exists := m.Get("a"); !exists || value != "changed" {
+		t.Errorf("Unexpected value of a: %v (%t)", value, exists)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != `{"z":0,"a":"changed","b":3}` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+}
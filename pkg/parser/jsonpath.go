@@ -0,0 +1,450 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+)
+
+// Selector selects children of an element in a segment of a JSONPath query (see QueryPart.Selectors).
+type Selector interface {
+	isSelector()
+}
+
+// NameSelector selects the member of an object with the name.
+type NameSelector struct {
+	Name string
+}
+
+// IndexSelector selects the item of an array at the index. Negative indices count from the end of the array.
+type IndexSelector struct {
+	Index int
+}
+
+// SliceSelector selects the items of an array from Start (inclusive) to End (exclusive) by Step.
+// Missing bounds are nil, their defaults depend on the direction of the step.
+type SliceSelector struct {
+	Start *int
+	End   *int
+	Step  int
+}
+
+// WildcardSelector selects all children of an object or array.
+type WildcardSelector struct{}
+
+// FilterSelector selects the children of an object or array matched by the filter.
+type FilterSelector struct {
+	Filter filters.Filter
+}
+
+func (NameSelector) isSelector()     {}
+func (IndexSelector) isSelector()    {}
+func (SliceSelector) isSelector()    {}
+func (WildcardSelector) isSelector() {}
+func (FilterSelector) isSelector()   {}
+
+// Position returns the position of the selected item in an array of the length.
+// The second return value is false if the index is out of range.
+func (s IndexSelector) Position(length int) (int, bool) {
+	i := s.Index
+	if i < 0 {
+		i += length
+	}
+	return i, i >= 0 && i < length
+}
+
+// Positions returns the positions of the selected items in an array of the length in the order of selection.
+func (s SliceSelector) Positions(length int) []int {
+	positions := []int{}
+	if s.Step == 0 {
+		return positions
+	}
+
+	normalize := func(bound *int, missing int) int {
+		if bound == nil {
+			return missing
+		} else if *bound < 0 {
+			return length + *bound
+		}
+		return *bound
+	}
+	clamp := func(i int, min int, max int) int {
+		if i < min {
+			return min
+		} else if i > max {
+			return max
+		}
+		return i
+	}
+
+	if s.Step > 0 {
+		lower := clamp(normalize(s.Start, 0), 0, length)
+		upper := clamp(normalize(s.End, length), 0, length)
+		for i := lower; i < upper; i += s.Step {
+			positions = append(positions, i)
+		}
+	} else {
+		upper := clamp(normalize(s.Start, length-1), -1, length-1)
+		lower := clamp(normalize(s.End, -1), -1, length-1)
+		for i := upper; lower < i; i += s.Step {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// maxJSONPathInt is the largest integer allowed in JSONPath indices and slices (I-JSON range).
+const maxJSONPathInt = 1<<53 - 1
+
+// jsonPathParser is a recursive descent parser of JSONPath queries.
+type jsonPathParser struct {
+	query []rune
+	pos   int
+}
+
+// ParseJSONPath parses an RFC 9535 JSONPath query, such as `$.store.book[?@.price<10].title`, into query parts,
+// which are evaluated from the root like UniQuery queries. Parts with selectors select children in the order
+// of the selectors, so that node lists can be built from them (see runner.RunJSONPathContext).
+func ParseJSONPath(query string) ([]QueryPart, error) {
+	p := &jsonPathParser{query: []rune(query)}
+
+	if !p.consume("$") {
+		return nil, fmt.Errorf("JSONPath query must begin with the root identifier '$'")
+	}
+
+	parts, _, err := p.segments()
+	if err != nil {
+		return nil, err
+	} else if !p.done() {
+		return nil, p.errorf("unexpected rune '%c'", p.peek())
+	}
+	return parts, nil
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSONPath at index %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonPathParser) done() bool {
+	return p.pos >= len(p.query)
+}
+
+// peek returns the current rune or zero at the end of the query.
+func (p *jsonPathParser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.query[p.pos]
+}
+
+func (p *jsonPathParser) lookingAt(s string) bool {
+	return strings.HasPrefix(string(p.query[p.pos:]), s)
+}
+
+// consume skips the string if the query continues with it.
+func (p *jsonPathParser) consume(s string) bool {
+	if p.lookingAt(s) {
+		p.pos += len([]rune(s))
+		return true
+	}
+	return false
+}
+
+func (p *jsonPathParser) expect(s string) error {
+	if !p.consume(s) {
+		if p.done() {
+			return p.errorf("expected '%s', got end of query", s)
+		}
+		return p.errorf("expected '%s', got '%c'", s, p.peek())
+	}
+	return nil
+}
+
+// skipBlank skips optional blank space (spaces, tabs and line breaks).
+func (p *jsonPathParser) skipBlank() {
+	for !p.done() && strings.ContainsRune(" \t\n\r", p.peek()) {
+		p.pos++
+	}
+}
+
+// segments parses the segments following the root or current node identifier.
+// The second return value is true if the query is singular (selects at most one node).
+func (p *jsonPathParser) segments() ([]QueryPart, bool, error) {
+	parts := []QueryPart{}
+	singular := true
+
+	for {
+		start := p.pos
+		p.skipBlank()
+		if p.peek() != '.' && p.peek() != '[' {
+			p.pos = start
+			return parts, singular, nil
+		}
+
+		descendant := p.consume("..")
+		if descendant {
+			parts = append(parts, QueryPart{Specifier: "**", Filters: []filters.Filter{}})
+		}
+
+		segmentStart := p.pos
+		selectors, err := p.segment(descendant)
+		if err != nil {
+			return nil, false, err
+		}
+
+		singular = singular && !descendant && len(selectors) == 1
+		if singular {
+			switch selectors[0].(type) {
+			case NameSelector, IndexSelector:
+			default:
+				singular = false
+			}
+		}
+
+		parts = append(parts, newSegmentPart(string(p.query[segmentStart:p.pos]), selectors))
+	}
+}
+
+// newSegmentPart creates the query part of a segment. Segments with a single wildcard or filter selector
+// are equivalent to the `*` specifier (with the filter), other segments use the selectors.
+func newSegmentPart(source string, selectors []Selector) QueryPart {
+	if len(selectors) == 1 {
+		switch s := selectors[0].(type) {
+		case WildcardSelector:
+			return QueryPart{Specifier: "*", Filters: []filters.Filter{}}
+		case FilterSelector:
+			return QueryPart{Specifier: "*", Filters: []filters.Filter{s.Filter}}
+		}
+	}
+	return QueryPart{Specifier: source, Filters: []filters.Filter{}, Literal: true, Selectors: selectors}
+}
+
+// segment parses a bracketed selection, or a wildcard or member name following a dot.
+// The dot has already been consumed if the segment is a descendant segment.
+func (p *jsonPathParser) segment(descendant bool) ([]Selector, error) {
+	if p.peek() == '[' {
+		return p.bracketedSelection()
+	} else if !descendant {
+		if err := p.expect("."); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.consume("*") {
+		return []Selector{WildcardSelector{}}, nil
+	} else if name := p.memberName(); name != "" {
+		return []Selector{NameSelector{Name: name}}, nil
+	}
+	return nil, p.errorf("expected a member name or a wildcard")
+}
+
+func isNameFirst(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+		(r >= 0x80 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0x10FFFF)
+}
+
+// memberName parses a member name shorthand. It returns an empty string if there is none.
+func (p *jsonPathParser) memberName() string {
+	start := p.pos
+	for !p.done() && (isNameFirst(p.peek()) || (p.pos > start && p.peek() >= '0' && p.peek() <= '9')) {
+		p.pos++
+	}
+	return string(p.query[start:p.pos])
+}
+
+func (p *jsonPathParser) bracketedSelection() ([]Selector, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	selectors := []Selector{}
+	for {
+		p.skipBlank()
+		selector, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+
+		p.skipBlank()
+		if p.consume("]") {
+			return selectors, nil
+		} else if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsonPathParser) selector() (Selector, error) {
+	switch r := p.peek(); {
+	case r == '\'' || r == '"':
+		name, err := p.stringLiteral()
+		return NameSelector{Name: name}, err
+
+	case p.consume("*"):
+		return WildcardSelector{}, nil
+
+	case p.consume("?"):
+		p.skipBlank()
+		start := p.pos
+		expr, err := p.logicalExpr()
+		if err != nil {
+			return nil, err
+		}
+		return FilterSelector{Filter: ExpressionFilter{source: string(p.query[start:p.pos]), expr: expr}}, nil
+	}
+
+	start, hasStart, err := p.optionalInt()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if !p.consume(":") {
+		if !hasStart {
+			return nil, p.errorf("expected a selector")
+		}
+		return IndexSelector{Index: start}, nil
+	}
+
+	slice := SliceSelector{Step: 1}
+	if hasStart {
+		slice.Start = &start
+	}
+
+	p.skipBlank()
+	end, hasEnd, err := p.optionalInt()
+	if err != nil {
+		return nil, err
+	} else if hasEnd {
+		slice.End = &end
+	}
+
+	p.skipBlank()
+	if p.consume(":") {
+		p.skipBlank()
+		step, hasStep, err := p.optionalInt()
+		if err != nil {
+			return nil, err
+		} else if hasStep {
+			slice.Step = step
+		}
+	}
+	return slice, nil
+}
+
+// optionalInt parses an integer, if the query continues with one.
+func (p *jsonPathParser) optionalInt() (int, bool, error) {
+	start := p.pos
+	p.consume("-")
+	digits := p.pos
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+
+	literal := string(p.query[start:p.pos])
+	if p.pos == digits {
+		if p.pos > start {
+			return 0, false, p.errorf("expected digits after '-'")
+		}
+		return 0, false, nil
+	} else if p.query[digits] == '0' && (p.pos > digits+1 || digits > start) {
+		return 0, false, p.errorf("invalid integer: %s", literal)
+	}
+
+	i, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil || i > maxJSONPathInt || i < -maxJSONPathInt {
+		return 0, false, p.errorf("integer out of range: %s", literal)
+	}
+	return int(i), true, nil
+}
+
+// stringLiteral parses a string in single or double quotes with JSON escapes.
+func (p *jsonPathParser) stringLiteral() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	sb := strings.Builder{}
+	for {
+		if p.done() {
+			return "", p.errorf("unterminated string literal")
+		}
+
+		r := p.peek()
+		p.pos++
+		switch {
+		case r == quote:
+			return sb.String(), nil
+
+		case r < 0x20:
+			return "", p.errorf("unescaped control character in string literal")
+
+		case r != '\\':
+			sb.WriteRune(r)
+
+		default:
+			escaped := p.peek()
+			p.pos++
+			switch escaped {
+			case 'b':
+				sb.WriteRune('\b')
+			case 'f':
+				sb.WriteRune('\f')
+			case 'n':
+				sb.WriteRune('\n')
+			case 'r':
+				sb.WriteRune('\r')
+			case 't':
+				sb.WriteRune('\t')
+			case '/', '\\', quote:
+				sb.WriteRune(escaped)
+			case 'u':
+				decoded, err := p.unicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				sb.WriteRune(decoded)
+			default:
+				return "", p.errorf("invalid escape sequence in string literal")
+			}
+		}
+	}
+}
+
+// unicodeEscape parses the hexadecimal digits of a \u escape, including the low surrogate of a surrogate pair.
+func (p *jsonPathParser) unicodeEscape() (rune, error) {
+	hex := func() (rune, error) {
+		if p.pos+4 > len(p.query) {
+			return 0, p.errorf("incomplete unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.query[p.pos:p.pos+4]), 16, 16)
+		if err != nil {
+			return 0, p.errorf("invalid unicode escape")
+		}
+		p.pos += 4
+		return rune(code), nil
+	}
+
+	high, err := hex()
+	if err != nil {
+		return 0, err
+	} else if high >= 0xDC00 && high <= 0xDFFF {
+		return 0, p.errorf("unpaired low surrogate in unicode escape")
+	} else if high < 0xD800 || high > 0xDBFF {
+		return high, nil
+	}
+
+	if !p.consume(`\u`) {
+		return 0, p.errorf("unpaired high surrogate in unicode escape")
+	}
+	low, err := hex()
+	if err != nil {
+		return 0, err
+	} else if low < 0xDC00 || low > 0xDFFF {
+		return 0, p.errorf("invalid low surrogate in unicode escape")
+	}
+	return utf16.DecodeRune(high, low), nil
+}
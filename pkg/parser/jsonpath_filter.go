@@ -0,0 +1,723 @@
+package parser
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+	"github.com/natiiix/uniquery/pkg/typed"
+)
+
+// EmbeddedQuery is a query within a JSONPath filter expression, such as `@.price` or `$.limit`.
+type EmbeddedQuery struct {
+	Parts []QueryPart
+	// Absolute queries are evaluated from the root of the document, others from the filtered element.
+	Absolute bool
+}
+
+// QueryContext evaluates the queries embedded in filters.
+type QueryContext interface {
+	// Query returns the values of the elements selected by the query. Containers are returned
+	// as generic maps and slices, numbers may be of any numeric type.
+	Query(query EmbeddedQuery) ([]interface{}, error)
+}
+
+// ContextFilter is a filter containing queries, which need the filtered element rather than just its value.
+// The runner matches elements using MatchContext instead of IsMatch.
+type ContextFilter interface {
+	filters.Filter
+	MatchContext(ctx QueryContext) (bool, error)
+}
+
+// ExpressionFilter is a JSONPath filter expression, such as `@.price < 10 && @.category == 'fiction'`.
+type ExpressionFilter struct {
+	source string
+	expr   logicalExpr
+}
+
+// String returns the source of the expression.
+func (f ExpressionFilter) String() string {
+	return f.source
+}
+
+// IsMatch always returns false, because the embedded queries cannot be evaluated on a value alone.
+// Elements are matched by MatchContext.
+func (f ExpressionFilter) IsMatch(value interface{}) bool {
+	return false
+}
+
+func (f ExpressionFilter) MatchContext(ctx QueryContext) (bool, error) {
+	return f.expr.test(ctx)
+}
+
+// logicalExpr is an expression of the JSONPath LogicalType.
+type logicalExpr interface {
+	test(ctx QueryContext) (bool, error)
+}
+
+// valueExpr is an expression of the JSONPath ValueType. Its second return value is false
+// if the result is Nothing (e.g. a query which does not select any element).
+type valueExpr interface {
+	value(ctx QueryContext) (interface{}, bool, error)
+}
+
+type orExpr []logicalExpr
+
+func (e orExpr) test(ctx QueryContext) (bool, error) {
+	for _, operand := range e {
+		if match, err := operand.test(ctx); err != nil || match {
+			return match, err
+		}
+	}
+	return false, nil
+}
+
+type andExpr []logicalExpr
+
+func (e andExpr) test(ctx QueryContext) (bool, error) {
+	for _, operand := range e {
+		if match, err := operand.test(ctx); err != nil || !match {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type notExpr struct {
+	operand logicalExpr
+}
+
+func (e notExpr) test(ctx QueryContext) (bool, error) {
+	match, err := e.operand.test(ctx)
+	return !match && err == nil, err
+}
+
+// existenceExpr tests whether the query selects any element.
+type existenceExpr struct {
+	query EmbeddedQuery
+}
+
+func (e existenceExpr) test(ctx QueryContext) (bool, error) {
+	values, err := ctx.Query(e.query)
+	return len(values) > 0, err
+}
+
+// literalExpr is a string, number, boolean or null literal.
+type literalExpr struct {
+	literal interface{}
+}
+
+func (e literalExpr) value(QueryContext) (interface{}, bool, error) {
+	return e.literal, true, nil
+}
+
+// singularQueryExpr is the value of the only element selected by a singular query.
+type singularQueryExpr struct {
+	query EmbeddedQuery
+}
+
+func (e singularQueryExpr) value(ctx QueryContext) (interface{}, bool, error) {
+	values, err := ctx.Query(e.query)
+	if err != nil || len(values) != 1 {
+		return nil, false, err
+	}
+	return values[0], true, nil
+}
+
+type comparisonExpr struct {
+	left     valueExpr
+	operator string
+	right    valueExpr
+}
+
+func (e comparisonExpr) test(ctx QueryContext) (bool, error) {
+	left, leftExists, err := e.left.value(ctx)
+	if err != nil {
+		return false, err
+	}
+	right, rightExists, err := e.right.value(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	equal := func() bool {
+		if !leftExists || !rightExists {
+			return leftExists == rightExists
+		}
+		return jsonEqual(left, right)
+	}
+	less := func(a interface{}, b interface{}) bool {
+		if !leftExists || !rightExists {
+			return false
+		}
+		return jsonLess(a, b)
+	}
+
+	switch e.operator {
+	case "==":
+		return equal(), nil
+	case "!=":
+		return !equal(), nil
+	case "<":
+		return less(left, right), nil
+	case "<=":
+		return less(left, right) || equal(), nil
+	case ">":
+		return less(right, left), nil
+	default:
+		return less(right, left) || equal(), nil
+	}
+}
+
+var float64Type = reflect.TypeOf(float64(0))
+
+// jsonNumber converts a number of any type to float64.
+func jsonNumber(value interface{}) (float64, bool) {
+	switch value.(type) {
+	case string, bool, nil:
+		return 0, false
+	}
+
+	converted, ok := typed.ConvertValue(value, float64Type)
+	if !ok {
+		return 0, false
+	}
+	return converted.Float(), true
+}
+
+// jsonEqual compares values like JSONPath does: numbers by their values, arrays and objects by their items and members.
+func jsonEqual(a interface{}, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x == y
+	}
+
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, exists := y[k]; !exists || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// jsonLess compares numbers by their values and strings by their code points. Other values are not ordered.
+func jsonLess(a interface{}, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x < y
+	} else if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		return ok && x < y
+	}
+	return false
+}
+
+// jsonPathType is a type of JSONPath function parameters and results.
+type jsonPathType int
+
+const (
+	valueType jsonPathType = iota
+	logicalType
+	nodesType
+)
+
+// jsonPathFunction is a function extension of JSONPath.
+type jsonPathFunction struct {
+	params []jsonPathType
+	result jsonPathType
+	call   func(args []interface{}) interface{}
+}
+
+// jsonPathFunctions are the functions defined by RFC 9535. Arguments of the value type are nil if they are Nothing.
+// Functions of the value type return nothing (rather than nil) if their result is Nothing.
+var jsonPathFunctions = map[string]jsonPathFunction{
+	"length": {params: []jsonPathType{valueType}, result: valueType, call: func(args []interface{}) interface{} {
+		switch t := args[0].(type) {
+		case string:
+			return utf8.RuneCountInString(t)
+		case []interface{}:
+			return len(t)
+		case map[string]interface{}:
+			return len(t)
+		default:
+			return nothing{}
+		}
+	}},
+	"count": {params: []jsonPathType{nodesType}, result: valueType, call: func(args []interface{}) interface{} {
+		return len(args[0].([]interface{}))
+	}},
+	"match": {params: []jsonPathType{valueType, valueType}, result: logicalType, call: func(args []interface{}) interface{} {
+		return matchIRegexp(args[0], args[1], true)
+	}},
+	"search": {params: []jsonPathType{valueType, valueType}, result: logicalType, call: func(args []interface{}) interface{} {
+		return matchIRegexp(args[0], args[1], false)
+	}},
+	"value": {params: []jsonPathType{nodesType}, result: valueType, call: func(args []interface{}) interface{} {
+		if nodes := args[0].([]interface{}); len(nodes) == 1 {
+			return nodes[0]
+		}
+		return nothing{}
+	}},
+}
+
+// nothing is the result of a function of the value type, which has no value.
+type nothing struct{}
+
+// matchIRegexp matches the string against the I-Regexp (RFC 9485), either entirely or anywhere within it.
+// Invalid regular expressions and values, which are not strings, do not match.
+func matchIRegexp(value interface{}, pattern interface{}, entire bool) bool {
+	str, ok := value.(string)
+	patternStr, patternOk := pattern.(string)
+	if !ok || !patternOk {
+		return false
+	}
+
+	// Dots of I-Regexps do not match line breaks, unlike dots of RE2, which only exclude line feeds.
+	sb := strings.Builder{}
+	escaped, class := false, false
+	for _, r := range patternStr {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '[':
+			class = true
+		case r == ']':
+			class = false
+		case r == '.' && !class:
+			sb.WriteString(`[^\n\r]`)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	converted := sb.String()
+	if entire {
+		converted = `^(?:` + converted + `)$`
+	}
+	regex, err := regexp.Compile(converted)
+	return err == nil && regex.MatchString(str)
+}
+
+// functionExpr is a call of a JSONPath function. Its arguments are valueExpr, logicalExpr or EmbeddedQuery,
+// according to the types of the parameters.
+type functionExpr struct {
+	function jsonPathFunction
+	args     []interface{}
+}
+
+func (e functionExpr) call(ctx QueryContext) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		switch t := arg.(type) {
+		case EmbeddedQuery:
+			values, err := ctx.Query(t)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = values
+
+		case valueExpr:
+			value, _, err := t.value(ctx)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+
+		case logicalExpr:
+			match, err := t.test(ctx)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = match
+		}
+	}
+	return e.function.call(args), nil
+}
+
+func (e functionExpr) value(ctx QueryContext) (interface{}, bool, error) {
+	result, err := e.call(ctx)
+	if _, isNothing := result.(nothing); err != nil || isNothing {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+func (e functionExpr) test(ctx QueryContext) (bool, error) {
+	result, err := e.call(ctx)
+	if nodes, ok := result.([]interface{}); ok {
+		return len(nodes) > 0, err
+	}
+	match, _ := result.(bool)
+	return match, err
+}
+
+// logicalExpr parses a logical expression, which consists of basic expressions joined by `||` and `&&`.
+func (p *jsonPathParser) logicalExpr() (logicalExpr, error) {
+	or := orExpr{}
+	for {
+		and := andExpr{}
+		for {
+			basic, err := p.basicExpr()
+			if err != nil {
+				return nil, err
+			}
+			and = append(and, basic)
+
+			if !p.consumeOperator("&&") {
+				break
+			}
+		}
+		or = append(or, simplifyAnd(and))
+
+		if !p.consumeOperator("||") {
+			break
+		}
+	}
+
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func simplifyAnd(and andExpr) logicalExpr {
+	if len(and) == 1 {
+		return and[0]
+	}
+	return and
+}
+
+// consumeOperator skips the operator surrounded by blank space. Nothing is skipped if the operator does not follow.
+func (p *jsonPathParser) consumeOperator(operator string) bool {
+	start := p.pos
+	p.skipBlank()
+	if p.consume(operator) {
+		p.skipBlank()
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+// comparisonOperator skips a comparison operator surrounded by blank space and returns it.
+func (p *jsonPathParser) comparisonOperator() string {
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consumeOperator(operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+// basicExpr parses a parenthesized expression, a comparison or a test of a query or function.
+func (p *jsonPathParser) basicExpr() (logicalExpr, error) {
+	if p.consume("!") {
+		p.skipBlank()
+		if p.consume("(") {
+			inner, err := p.parenthesized()
+			return notExpr{inner}, err
+		}
+
+		operand, err := p.testExpr()
+		return notExpr{operand}, err
+	} else if p.consume("(") {
+		return p.parenthesized()
+	}
+
+	// Queries and functions are compared if a comparison operator follows them, otherwise they are tested.
+	start := p.pos
+	_, isLiteral, err := p.literal()
+	if err != nil {
+		return nil, err
+	} else if !isLiteral && p.lookingAtFunction() {
+		_, _, err = p.function()
+	} else if !isLiteral {
+		_, _, err = p.embeddedQuery()
+	}
+	if err != nil {
+		return nil, err
+	}
+	isComparison := p.comparisonOperator() != ""
+	p.pos = start
+
+	if isLiteral && !isComparison {
+		return nil, p.errorf("literal must be compared")
+	} else if !isComparison {
+		return p.testExpr()
+	}
+
+	left, err := p.comparable()
+	if err != nil {
+		return nil, err
+	}
+	operator := p.comparisonOperator()
+	right, err := p.comparable()
+	if err != nil {
+		return nil, err
+	}
+	return comparisonExpr{left: left, operator: operator, right: right}, nil
+}
+
+// parenthesized parses the rest of a parenthesized expression after the opening parenthesis.
+func (p *jsonPathParser) parenthesized() (logicalExpr, error) {
+	p.skipBlank()
+	inner, err := p.logicalExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	return inner, p.expect(")")
+}
+
+// testExpr parses a query tested for existence or a function of the logical or nodes type.
+func (p *jsonPathParser) testExpr() (logicalExpr, error) {
+	if p.lookingAtFunction() {
+		fn, result, err := p.function()
+		if err != nil {
+			return nil, err
+		} else if result == valueType {
+			return nil, p.errorf("result of a function of the value type must be compared")
+		}
+		return fn, nil
+	}
+
+	query, _, err := p.embeddedQuery()
+	if err != nil {
+		return nil, err
+	}
+	return existenceExpr{query}, nil
+}
+
+// comparable parses a literal, a singular query or a function of the value type.
+func (p *jsonPathParser) comparable() (valueExpr, error) {
+	if literal, isLiteral, err := p.literal(); err != nil || isLiteral {
+		return literal, err
+	} else if p.lookingAtFunction() {
+		fn, result, err := p.function()
+		if err != nil {
+			return nil, err
+		} else if result != valueType {
+			return nil, p.errorf("result of a function of the logical type cannot be compared")
+		}
+		return fn, nil
+	}
+
+	query, singular, err := p.embeddedQuery()
+	if err != nil {
+		return nil, err
+	} else if !singular {
+		return nil, p.errorf("only singular queries can be compared")
+	}
+	return singularQueryExpr{query}, nil
+}
+
+// embeddedQuery parses a query relative to the current node (`@`) or the root (`$`).
+func (p *jsonPathParser) embeddedQuery() (EmbeddedQuery, bool, error) {
+	absolute := p.consume("$")
+	if !absolute && !p.consume("@") {
+		return EmbeddedQuery{}, false, p.errorf("expected a query beginning with '@' or '$'")
+	}
+
+	parts, singular, err := p.segments()
+	return EmbeddedQuery{Parts: parts, Absolute: absolute}, singular, err
+}
+
+// literal parses a number, string, boolean or null literal, if the query continues with one.
+func (p *jsonPathParser) literal() (literalExpr, bool, error) {
+	switch r := p.peek(); {
+	case r == '\'' || r == '"':
+		str, err := p.stringLiteral()
+		return literalExpr{str}, true, err
+
+	case r == '-' || (r >= '0' && r <= '9'):
+		number, err := p.number()
+		return literalExpr{number}, true, err
+	}
+
+	for _, keyword := range []struct {
+		name  string
+		value interface{}
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		if p.lookingAt(keyword.name) && !p.lookingAtFunction() {
+			p.pos += len(keyword.name)
+			return literalExpr{keyword.value}, true, nil
+		}
+	}
+	return literalExpr{}, false, nil
+}
+
+// number parses a number literal, which is an integer (or -0) with optional fraction and exponent.
+func (p *jsonPathParser) number() (float64, error) {
+	start := p.pos
+	digits := func() int {
+		count := 0
+		for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+			count++
+		}
+		return count
+	}
+
+	p.consume("-")
+	intStart := p.pos
+	if count := digits(); count == 0 || (count > 1 && p.query[intStart] == '0') {
+		return 0, p.errorf("invalid number: %s", string(p.query[start:p.pos]))
+	}
+	if p.consume(".") && digits() == 0 {
+		return 0, p.errorf("expected digits of the fraction")
+	}
+	if p.consume("e") || p.consume("E") {
+		if !p.consume("-") {
+			p.consume("+")
+		}
+		if digits() == 0 {
+			return 0, p.errorf("expected digits of the exponent")
+		}
+	}
+
+	number, err := strconv.ParseFloat(string(p.query[start:p.pos]), 64)
+	if err != nil {
+		return 0, p.errorf("invalid number: %s", string(p.query[start:p.pos]))
+	}
+	return number, nil
+}
+
+// lookingAtFunction checks whether the query continues with a function name followed by a parenthesis.
+func (p *jsonPathParser) lookingAtFunction() bool {
+	i := p.pos
+	for i < len(p.query) && ((p.query[i] >= 'a' && p.query[i] <= 'z') || (i > p.pos && (p.query[i] == '_' || (p.query[i] >= '0' && p.query[i] <= '9')))) {
+		i++
+	}
+	return i > p.pos && i < len(p.query) && p.query[i] == '('
+}
+
+// function parses a function call and checks the types of its arguments. It returns the type of its result.
+func (p *jsonPathParser) function() (functionExpr, jsonPathType, error) {
+	start := p.pos
+	for p.peek() != '(' {
+		p.pos++
+	}
+	name := string(p.query[start:p.pos])
+	p.pos++
+
+	function, exists := jsonPathFunctions[name]
+	if !exists {
+		p.pos = start
+		return functionExpr{}, 0, p.errorf("unknown function: %s", name)
+	}
+
+	fn := functionExpr{function: function}
+	p.skipBlank()
+	for !p.consume(")") {
+		if len(fn.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return functionExpr{}, 0, err
+			}
+			p.skipBlank()
+		}
+		if len(fn.args) >= len(function.params) {
+			return functionExpr{}, 0, p.errorf("too many arguments of function %s", name)
+		}
+
+		arg, err := p.functionArgument(function.params[len(fn.args)])
+		if err != nil {
+			return functionExpr{}, 0, err
+		}
+		fn.args = append(fn.args, arg)
+		p.skipBlank()
+	}
+
+	if len(fn.args) != len(function.params) {
+		return functionExpr{}, 0, p.errorf("function %s expects %d arguments, got %d", name, len(function.params), len(fn.args))
+	}
+	return fn, function.result, nil
+}
+
+// argumentEnds checks whether an argument ends at the current position.
+func (p *jsonPathParser) argumentEnds() bool {
+	start := p.pos
+	p.skipBlank()
+	ends := p.peek() == ',' || p.peek() == ')'
+	p.pos = start
+	return ends
+}
+
+// functionArgument parses an argument of the parameter type.
+func (p *jsonPathParser) functionArgument(param jsonPathType) (interface{}, error) {
+	start := p.pos
+
+	// Literals, queries and functions are single arguments, unless they are a part of a logical expression.
+	if literal, isLiteral, err := p.literal(); err != nil {
+		return nil, err
+	} else if isLiteral && p.argumentEnds() {
+		if param != valueType {
+			return nil, p.errorf("literal cannot be an argument of the nodes or logical type")
+		}
+		return literal, nil
+	}
+	p.pos = start
+
+	if p.peek() == '@' || p.peek() == '$' {
+		query, singular, err := p.embeddedQuery()
+		if err != nil {
+			return nil, err
+		} else if p.argumentEnds() {
+			switch {
+			case param == valueType && !singular:
+				return nil, p.errorf("only singular queries can be arguments of the value type")
+			case param == valueType:
+				return singularQueryExpr{query}, nil
+			case param == logicalType:
+				return existenceExpr{query}, nil
+			default:
+				return query, nil
+			}
+		}
+	} else if p.lookingAtFunction() {
+		fn, result, err := p.function()
+		if err != nil {
+			return nil, err
+		} else if p.argumentEnds() {
+			if result != param && !(param == logicalType && result == nodesType) {
+				return nil, p.errorf("function result does not match the type of the parameter")
+			}
+			return fn, nil
+		}
+	}
+	p.pos = start
+
+	expr, err := p.logicalExpr()
+	if err != nil {
+		return nil, err
+	} else if param != logicalType {
+		return nil, p.errorf("logical expression cannot be an argument of the value or nodes type")
+	}
+	return expr, nil
+}
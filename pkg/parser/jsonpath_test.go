@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func segment(source string, selectors ...Selector) QueryPart {
+	return QueryPart{Specifier: source, Filters: []filters.Filter{}, Literal: true, Selectors: selectors}
+}
+
+var testTabParseJSONPath = []struct {
+	query string
+	parts []QueryPart
+}{
+	{`$`, []QueryPart{}},
+	{`$.a`, []QueryPart{segment(`.a`, NameSelector{Name: "a"})}},
+	{`$.a.b_1`, []QueryPart{segment(`.a`, NameSelector{Name: "a"}), segment(`.b_1`, NameSelector{Name: "b_1"})}},
+	{`$.čeština`, []QueryPart{segment(`.čeština`, NameSelector{Name: "čeština"})}},
+	{`$['a']["b"]`, []QueryPart{segment(`['a']`, NameSelector{Name: "a"}), segment(`["b"]`, NameSelector{Name: "b"})}},
+	{`$['\'\né😀']`, []QueryPart{segment(`['\'\né😀']`, NameSelector{Name: "'\né😀"})}},
+	{`$[0]`, []QueryPart{segment(`[0]`, IndexSelector{Index: 0})}},
+	{`$[-1]`, []QueryPart{segment(`[-1]`, IndexSelector{Index: -1})}},
+	{`$[ 1 , 'a' ]`, []QueryPart{segment(`[ 1 , 'a' ]`, IndexSelector{Index: 1}, NameSelector{Name: "a"})}},
+	{`$[1:3]`, []QueryPart{segment(`[1:3]`, SliceSelector{Start: intPtr(1), End: intPtr(3), Step: 1})}},
+	{`$[::-1]`, []QueryPart{segment(`[::-1]`, SliceSelector{Step: -1})}},
+	{`$[:2:0]`, []QueryPart{segment(`[:2:0]`, SliceSelector{End: intPtr(2), Step: 0})}},
+	// Segments with a single wildcard are equivalent to the `*` specifier.
+	{`$.*`, []QueryPart{{Specifier: "*", Filters: []filters.Filter{}}}},
+	{`$[*]`, []QueryPart{{Specifier: "*", Filters: []filters.Filter{}}}},
+	{`$[*, *]`, []QueryPart{segment(`[*, *]`, WildcardSelector{}, WildcardSelector{})}},
+	// Descendant segments select the children of the element and all its descendants.
+	{`$..a`, []QueryPart{{Specifier: "**", Filters: []filters.Filter{}}, segment(`a`, NameSelector{Name: "a"})}},
+	{`$..[0]`, []QueryPart{{Specifier: "**", Filters: []filters.Filter{}}, segment(`[0]`, IndexSelector{Index: 0})}},
+	{`$..*`, []QueryPart{{Specifier: "**", Filters: []filters.Filter{}}, {Specifier: "*", Filters: []filters.Filter{}}}},
+	{`$ .a [0]`, []QueryPart{segment(`.a`, NameSelector{Name: "a"}), segment(`[0]`, IndexSelector{Index: 0})}},
+}
+
+// Filter expressions are not compared, only their validity is checked.
+var testTabParseJSONPathFilters = []string{
+	`$[?@.a]`,
+	`$[?!@.a]`,
+	`$[?@.a == 1]`,
+	`$[?@.a != 'x' && @.b < 2.5e1 || @.c >= -1]`,
+	`$[?(@.a == true) && !(@.b == null)]`,
+	`$[?@ == $.a[0]]`,
+	`$[?@.*]`,
+	`$[?@..a]`,
+	`$[?length(@.a) > 1]`,
+	`$[?count(@.*) == 2]`,
+	`$[?match(@.a, 'a.*')]`,
+	`$[?search(@.a, $.pattern)]`,
+	`$[?value(@..a) == 1]`,
+	`$[?@.a, ?@.b]`,
+	`$..[?@.a]`,
+}
+
+var testTabParseJSONPathErrors = []string{
+	``,
+	`a`,
+	`$.`,
+	`$..`,
+	`$.1a`,
+	`$a`,
+	`$[`,
+	`$[]`,
+	`$[0`,
+	`$[0,]`,
+	`$['a`,
+	`$['\x']`,
+	`$['\ud83d']`,
+	`$['\ude00']`,
+	"$['\n']",
+	`$[01]`,
+	`$[-0]`,
+	`$[-]`,
+	`$[9007199254740992]`,
+	`$[?]`,
+	`$[?@.a ==]`,
+	`$[?@.* == 1]`,
+	`$[?@.a == @..b]`,
+	`$[?length(@.a)]`,
+	`$[?count(1) == 1]`,
+	`$[?match(@.a)]`,
+	`$[?unknown(@.a)]`,
+	`$[?@.a = 1]`,
+	`$[?(@.a]`,
+	`$[?1]`,
+	`$.a)`,
+}
+
+func TestParseJSONPath(t *testing.T) {
+	for _, entry := range testTabParseJSONPath {
+		parts, err := ParseJSONPath(entry.query)
+		if err != nil {
+			t.Errorf("Query `%s` returned an error: %v", entry.query, err)
+		} else if !cmp.Equal(parts, entry.parts) {
+			t.Errorf("Unexpected parts of query `%s`: %s", entry.query, cmp.Diff(entry.parts, parts))
+		}
+	}
+
+	for _, query := range testTabParseJSONPathFilters {
+		if _, err := ParseJSONPath(query); err != nil {
+			t.Errorf("Query `%s` returned an error: %v", query, err)
+		}
+	}
+
+	for _, query := range testTabParseJSONPathErrors {
+		if _, err := ParseJSONPath(query); err == nil {
+			t.Errorf("Query `%s` was expected to fail", query)
+		}
+	}
+}
+
+var testTabSelectorPositions = []struct {
+	selector  Selector
+	length    int
+	positions []int
+}{
+	{IndexSelector{Index: 0}, 3, []int{0}},
+	{IndexSelector{Index: -1}, 3, []int{2}},
+	{IndexSelector{Index: 3}, 3, []int{}},
+	{IndexSelector{Index: -4}, 3, []int{}},
+	{SliceSelector{Step: 1}, 3, []int{0, 1, 2}},
+	{SliceSelector{Start: intPtr(1), End: intPtr(3), Step: 1}, 5, []int{1, 2}},
+	{SliceSelector{Start: intPtr(-2), Step: 1}, 5, []int{3, 4}},
+	{SliceSelector{End: intPtr(10), Step: 2}, 5, []int{0, 2, 4}},
+	{SliceSelector{Step: -1}, 3, []int{2, 1, 0}},
+	{SliceSelector{Start: intPtr(3), End: intPtr(0), Step: -2}, 5, []int{3, 1}},
+	{SliceSelector{Start: intPtr(-10), End: intPtr(10), Step: -1}, 5, []int{}},
+	{SliceSelector{Step: 0}, 5, []int{}},
+	{SliceSelector{Step: 1}, 0, []int{}},
+}
+
+func TestSelectorPositions(t *testing.T) {
+	for _, entry := range testTabSelectorPositions {
+		positions := []int{}
+		switch s := entry.selector.(type) {
+		case IndexSelector:
+			if i, ok := s.Position(entry.length); ok {
+				positions = append(positions, i)
+			}
+
+		case SliceSelector:
+			positions = s.Positions(entry.length)
+		}
+
+		if !cmp.Equal(positions, entry.positions) {
+			t.Errorf("Unexpected positions of %+v in array of length %d: %v instead of %v", entry.selector, entry.length, positions, entry.positions)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package parser
 
 import (
-	"log"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -11,6 +11,27 @@ import (
 type QueryPart struct {
 	Specifier string
 	Filters   []filters.Filter
+	// Literal is true if the specifier contains a quoted or escaped rune. Literal specifiers always select
+	// the child of the same key, so that `""`, `"*"` and `"**"` do not navigate to the parent or select all children.
+	Literal bool
+	// Selectors select the children instead of the specifier, if there are any. They are used by JSONPath
+	// segments with multiple selectors, names, indices and slices (see ParseJSONPath).
+	Selectors []Selector
+}
+
+// IsParent checks whether the part navigates to the parent.
+func (p QueryPart) IsParent() bool {
+	return p.Specifier == "" && !p.Literal
+}
+
+// IsWildcard checks whether the part selects all children.
+func (p QueryPart) IsWildcard() bool {
+	return p.Specifier == "*" && !p.Literal
+}
+
+// IsRecursive checks whether the part selects the element and all its descendants.
+func (p QueryPart) IsRecursive() bool {
+	return p.Specifier == "**" && !p.Literal
 }
 
 const (
@@ -20,6 +41,7 @@ const (
 	equalityRune  = '='
 	regexRune     = '~'
 	invertRune    = '!'
+	dateTimeRune  = '@'
 )
 
 const (
@@ -27,10 +49,26 @@ const (
 	filterRegex
 )
 
-func ParseSinglePart(query []rune) (string, int) {
+// specifierStopRunes end a specifier, because they begin the next specifier or a filter.
+// Operands of equality and regex filters do not end at '@', so that they may contain it (e.g. `*=john@example.com`).
+// Named and date and time filters may begin only after a specifier or another filter.
+const (
+	specifierStopRunes = string(specifierRune) + string(equalityRune) + string(regexRune) + string(invertRune) + string(dateTimeRune)
+	operandStopRunes   = string(specifierRune) + string(equalityRune) + string(regexRune) + string(invertRune)
+)
+
+func ParseSinglePart(query []rune) (string, int, error) {
+	part, length, _, err := parseSinglePart(query, specifierStopRunes)
+	return part, length, err
+}
+
+// parseSinglePart is ParseSinglePart, which also reports whether the part contains a quoted or escaped rune.
+// The part ends at the first unquoted and unescaped rune of stopRunes.
+func parseSinglePart(query []rune, stopRunes string) (string, int, bool, error) {
 	sb := strings.Builder{}
 	escaped := false
 	quoted := false
+	literal := false
 
 	for i, r := range query {
 		if escaped {
@@ -43,15 +81,18 @@ func ParseSinglePart(query []rune) (string, int) {
 				sb.WriteRune(r)
 			}
 		} else {
-			switch r {
-			case specifierRune, equalityRune, regexRune, invertRune:
-				return sb.String(), i
+			if strings.ContainsRune(stopRunes, r) {
+				return sb.String(), i, literal, nil
+			}
 
+			switch r {
 			case escapeRune:
 				escaped = true
+				literal = true
 
 			case quoteRune:
 				quoted = true
+				literal = true
 
 			default:
 				sb.WriteRune(r)
@@ -60,64 +101,128 @@ func ParseSinglePart(query []rune) (string, int) {
 	}
 
 	if escaped || quoted {
-		log.Fatalln("Unexpected end of query - trailing escape or quote")
+		return "", 0, false, fmt.Errorf("unexpected end of query - trailing escape or quote")
 	}
 
-	return sb.String(), len(query)
+	return sb.String(), len(query), literal, nil
 }
 
-func ParseSingleFilter(query []rune) (filters.Filter, int) {
+func ParseSingleFilter(query []rune) (filters.Filter, int, error) {
 	if len(query) <= 0 {
-		log.Fatalln("Unexpected end of filter")
-		return nil, 0
+		return nil, 0, fmt.Errorf("unexpected end of filter")
 	}
 
 	switch query[0] {
 	case specifierRune:
-		return nil, 0
+		return nil, 0, nil
 
 	case equalityRune:
-		value, len := ParseSinglePart(query[1:])
-		return filters.EqualityFilter{Value: value}, 1 + len
+		value, len, _, err := parseSinglePart(query[1:], operandStopRunes)
+		if err != nil {
+			return nil, 0, err
+		}
+		return filters.EqualityFilter{Value: value}, 1 + len, nil
 
 	case regexRune:
-		regex, len := ParseSinglePart(query[1:])
-		return filters.RegexFilter{Regex: regexp.MustCompile(regex)}, 1 + len
+		regex, len, _, err := parseSinglePart(query[1:], operandStopRunes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		compiled, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, 0, err
+		}
+		return filters.RegexFilter{Regex: compiled}, 1 + len, nil
+
+	case dateTimeRune:
+		if call, callLength := ScanCall(query[1:]); call != nil {
+			args := make([]string, len(call.Args))
+			for i, arg := range call.Args {
+				args[i] = Unquote(arg)
+			}
+
+			filter, err := filters.NewNamed(call.Name, args)
+			if err != nil {
+				return nil, 0, err
+			}
+			return filter, 1 + callLength, nil
+		}
+
+		operatorLength := 0
+		for 1+operatorLength < len(query) && strings.ContainsRune("<>=", query[1+operatorLength]) {
+			operatorLength++
+		}
+
+		operator := string(query[1 : 1+operatorLength])
+		if !isDateTimeOperator(operator) {
+			return nil, 0, fmt.Errorf("invalid date and time comparison operator: '%s'", operator)
+		}
+
+		value, len, err := ParseSinglePart(query[1+operatorLength:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		reference, err := filters.ParseTimeReference(value)
+		if err != nil {
+			return nil, 0, err
+		}
+		return filters.DateTimeFilter{Operator: operator, Reference: reference}, 1 + operatorLength + len, nil
 
 	case invertRune:
-		inner, len := ParseSingleFilter(query[1:])
-		return filters.InvertFilter{InnerFilter: inner}, 1 + len
+		inner, len, err := ParseSingleFilter(query[1:])
+		if err != nil {
+			return nil, 0, err
+		} else if inner == nil {
+			return nil, 0, fmt.Errorf("unexpected end of inverted filter")
+		}
+		return filters.InvertFilter{InnerFilter: inner}, 1 + len, nil
 
 	default:
-		log.Fatalln("Unexpected filter prefix:", string(query[0]))
-		return nil, 0
+		return nil, 0, fmt.Errorf("unexpected filter prefix: %s", string(query[0]))
 	}
 }
 
-func ParseQuery(query string) []QueryPart {
+func isDateTimeOperator(operator string) bool {
+	for _, op := range filters.DateTimeOperators {
+		if op == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ParseQuery(query string) ([]QueryPart, error) {
 	queryRunes := []rune(query)
 	parts := []QueryPart{}
 
 	// Empty query has no query parts.
 	if len(queryRunes) == 0 {
-		return parts
+		return parts, nil
 	} else if queryRunes[0] == specifierRune {
-		log.Fatalf("Query must not begin with the specifier prefix rune '%c'\n", specifierRune)
+		return nil, fmt.Errorf("query must not begin with the specifier prefix rune '%c'", specifierRune)
 	}
 
 	for i := 0; i < len(queryRunes) + 1; i++ {
 		// Every specifier must be prefixed by the specifier rune.
 		if i > 0 && queryRunes[i - 1] != specifierRune {
-			log.Fatalf("Unexpected rune '%c' at index %d (expected a specifier prefix rune '%c')\n", queryRunes[i], i, specifierRune)
+			return nil, fmt.Errorf("unexpected rune '%c' at index %d (expected a specifier prefix rune '%c')", queryRunes[i], i, specifierRune)
 		}
 
-		specifier, specifierLength := ParseSinglePart(queryRunes[i:])
+		specifier, specifierLength, literal, err := parseSinglePart(queryRunes[i:], specifierStopRunes)
+		if err != nil {
+			return nil, err
+		}
 		i += specifierLength
 
 		filters := []filters.Filter{}
 
 		for i < len(queryRunes) {
-			if filter, filterLength := ParseSingleFilter(queryRunes[i:]); filter != nil {
+			if filter, filterLength, err := ParseSingleFilter(queryRunes[i:]); err != nil {
+				return nil, err
+			} else if filter != nil {
 				filters = append(filters, filter)
 				i += filterLength
 			} else {
@@ -125,8 +230,8 @@ func ParseQuery(query string) []QueryPart {
 			}
 		}
 
-		parts = append(parts, QueryPart{Specifier: specifier, Filters: filters})
+		parts = append(parts, QueryPart{Specifier: specifier, Filters: filters, Literal: literal})
 	}
 
-	return parts
+	return parts, nil
 }
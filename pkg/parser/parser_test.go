@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+)
+
+// compareRegex compares regular expressions by their source, because compiled ones have unexported fields.
+var compareRegex = cmp.Comparer(func(a, b *regexp.Regexp) bool {
+	return a.String() == b.String()
+})
+
+func part(specifier string, literal bool, f ...filters.Filter) QueryPart {
+	if f == nil {
+		f = []filters.Filter{}
+	}
+	return QueryPart{Specifier: specifier, Filters: f, Literal: literal}
+}
+
+var testTabParseQuery = []struct {
+	query string
+	parts []QueryPart
+}{
+	{``, []QueryPart{}},
+	{`a`, []QueryPart{part("a", false)}},
+	{`a.b.0`, []QueryPart{part("a", false), part("b", false), part("0", false)}},
+	{`a.`, []QueryPart{part("a", false), part("", false)}},
+	{`**.*`, []QueryPart{part("**", false), part("*", false)}},
+	{`"**"."*".""`, []QueryPart{part("**", true), part("*", true), part("", true)}},
+	{`a\.b."c.d"`, []QueryPart{part("a.b", true), part("c.d", true)}},
+	{`say\ \"hi\"`, []QueryPart{part(`say "hi"`, true)}},
+	// Escapes have no effect inside quotes.
+	{`"a\b"`, []QueryPart{part(`a\b`, true)}},
+	{`*=`, []QueryPart{part("*", false, filters.EqualityFilter{Value: ""})}},
+	{`*=a=b`, []QueryPart{part("*", false, filters.EqualityFilter{Value: "a"}, filters.EqualityFilter{Value: "b"})}},
+	{`*="1.5"`, []QueryPart{part("*", false, filters.EqualityFilter{Value: "1.5"})}},
+	{`*=root@localhost`, []QueryPart{part("*", false, filters.EqualityFilter{Value: "root@localhost"})}},
+	{`*~^a|b$`, []QueryPart{part("*", false, filters.RegexFilter{Regex: regexp.MustCompile(`^a|b$`)})}},
+	{`*!=a.b`, []QueryPart{part("*", false, filters.InvertFilter{InnerFilter: filters.EqualityFilter{Value: "a"}}), part("b", false)}},
+	{`*!!~a`, []QueryPart{part("*", false, filters.InvertFilter{InnerFilter: filters.InvertFilter{InnerFilter: filters.RegexFilter{Regex: regexp.MustCompile(`a`)}}})}},
+	{`*@>=2024-01-01`, []QueryPart{part("*", false, filters.DateTimeFilter{Operator: ">=", Reference: filters.TimeReference{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}})}},
+	{`*@<now-7d`, []QueryPart{part("*", false, filters.DateTimeFilter{Operator: "<", Reference: filters.TimeReference{Now: true, Offset: -7 * 24 * time.Hour}})}},
+}
+
+var testTabParseQueryErrors = []string{
+	`.a`,
+	`a"b`,
+	`a\`,
+	`*~(`,
+	`*!`,
+	`*@`,
+	`*@<>now`,
+	`*@<never`,
+	`*@unknown`,
+	`*=a"b`,
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, entry := range testTabParseQuery {
+		parts, err := ParseQuery(entry.query)
+		if err != nil {
+			t.Errorf("Query `%s` returned an error: %v", entry.query, err)
+		} else if !cmp.Equal(parts, entry.parts, compareRegex) {
+			t.Errorf("Unexpected parts of query `%s`: %s", entry.query, cmp.Diff(entry.parts, parts, compareRegex))
+		}
+	}
+
+	for _, query := range testTabParseQueryErrors {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Query `%s` was expected to fail", query)
+		}
+	}
+}
+
+var testTabQueryPartKinds = []struct {
+	part      QueryPart
+	parent    bool
+	wildcard  bool
+	recursive bool
+}{
+	{part("", false), true, false, false},
+	{part("*", false), false, true, false},
+	{part("**", false), false, false, true},
+	// Literal specifiers always select the child of the same key.
+	{part("", true), false, false, false},
+	{part("*", true), false, false, false},
+	{part("**", true), false, false, false},
+	{part("a", false), false, false, false},
+}
+
+func TestQueryPartKinds(t *testing.T) {
+	for _, entry := range testTabQueryPartKinds {
+		if entry.part.IsParent() != entry.parent || entry.part.IsWildcard() != entry.wildcard || entry.part.IsRecursive() != entry.recursive {
+			t.Errorf("Unexpected kind of part %+v", entry.part)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/natiiix/uniquery/internal/ident"
+	"github.com/natiiix/uniquery/pkg/functions"
+)
+
+// Stage is a single step of a pipeline. Exactly one of its fields is set.
+type Stage struct {
+	Parts []QueryPart
+	Call  *Call
+}
+
+// Call is an operator or function invocation, such as `count_by(status)`.
+// Arguments are kept verbatim (including quotes and escapes),
+// because some of them are queries and need to be parsed again.
+type Call struct {
+	Name string
+	Args []string
+	// Function is the function resolved by ParsePipeline. It is nil for operators.
+	Function functions.Function
+	// Pipelines are the arguments of operators parsed by ParsePipeline. They are nil for functions.
+	Pipelines [][]Stage
+	// Labels are the labels of the arguments of labeled operators (see Operator).
+	Labels []string
+}
+
+const (
+	pipeRune       = '|'
+	argsBeginRune  = '('
+	argsEndRune    = ')'
+	argsSepRune    = ','
+	labelSepRune   = ':'
+	whitespaceRune = ' '
+)
+
+// splitPipeline splits the query on every pipe rune that is surrounded by whitespace and neither escaped nor quoted.
+// Pipes without whitespace around them belong to the stage, so that regular expressions such as `~^a|b` keep working.
+// Pipes within arguments of calls (such as `project(name: name | upper())`) belong to the arguments.
+// Escapes and quotes are kept in the segments, so that they can be parsed again later.
+func splitPipeline(query []rune) [][]rune {
+	segments := [][]rune{}
+	start := 0
+	escaped := false
+	quoted := false
+	// separated is set if the previous rune is whitespace that is neither escaped nor quoted.
+	separated := false
+	// depth is the number of open parentheses of calls. Parentheses outside of calls (such as in regular expressions)
+	// are not counted, so that they do not need to be balanced.
+	depth := 0
+
+	for i, r := range query {
+		if escaped {
+			escaped = false
+			separated = false
+			continue
+		}
+
+		if r == quoteRune {
+			quoted = !quoted
+		} else if r == escapeRune && !quoted {
+			escaped = true
+		} else if r == argsBeginRune && !quoted && (depth > 0 || (i > 0 && ident.IsRune(query[i-1], false))) {
+			depth++
+		} else if r == argsEndRune && !quoted && depth > 0 {
+			depth--
+		} else if r == pipeRune && !quoted && depth == 0 && separated && (i+1 == len(query) || query[i+1] == whitespaceRune) {
+			segments = append(segments, query[start:i])
+			start = i + 1
+		}
+
+		separated = r == whitespaceRune && !quoted
+	}
+
+	return append(segments, query[start:])
+}
+
+// ScanCall reads a call in the form of `name` or `name(arg1, arg2, ...)` from the beginning of the query.
+// Arguments may contain balanced parentheses, such as calls of their own.
+// It returns the call and the number of runes it spans, or nil if the query does not begin with a call.
+func ScanCall(query []rune) (*Call, int) {
+	nameEnd := 0
+	for nameEnd < len(query) && ident.IsRune(query[nameEnd], nameEnd == 0) {
+		nameEnd++
+	}
+
+	if nameEnd == 0 {
+		return nil, 0
+	}
+
+	call := &Call{Name: string(query[:nameEnd]), Args: []string{}}
+	if nameEnd >= len(query) || query[nameEnd] != argsBeginRune {
+		return call, nameEnd
+	}
+
+	argsStart := nameEnd + 1
+	start := argsStart
+	escaped := false
+	quoted := false
+	// depth is the number of open parentheses within the arguments.
+	depth := 0
+
+	for i := argsStart; i < len(query); i++ {
+		r := query[i]
+
+		if escaped {
+			escaped = false
+		} else if r == quoteRune {
+			quoted = !quoted
+		} else if r == escapeRune && !quoted {
+			escaped = true
+		} else if quoted {
+			continue
+		} else if r == argsBeginRune {
+			depth++
+		} else if r == argsEndRune && depth > 0 {
+			depth--
+		} else if (r == argsSepRune || r == argsEndRune) && depth == 0 {
+			arg := strings.TrimSpace(string(query[start:i]))
+			// Empty parentheses mean no arguments, not a single empty argument.
+			if r == argsSepRune || arg != "" || start != argsStart {
+				call.Args = append(call.Args, arg)
+			}
+			start = i + 1
+
+			if r == argsEndRune {
+				return call, i + 1
+			}
+		}
+	}
+
+	return nil, 0
+}
+
+// ParseCall parses a call in the form of `name(arg1, arg2, ...)`.
+// The second return value is false if the query is not a call.
+func ParseCall(query []rune) (*Call, bool) {
+	call, length := ScanCall(query)
+	if call == nil || length != len(query) || query[length-1] != argsEndRune {
+		return nil, false
+	}
+
+	return call, true
+}
+
+// Unquote removes quotes and escapes from a call argument.
+// Same as in queries, escapes have no effect inside quotes.
+func Unquote(arg string) string {
+	sb := strings.Builder{}
+	escaped := false
+	quoted := false
+
+	for _, r := range arg {
+		if escaped {
+			sb.WriteRune(r)
+			escaped = false
+		} else if r == quoteRune {
+			quoted = !quoted
+		} else if r == escapeRune && !quoted {
+			escaped = true
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// Operator describes the arguments of an operator, which are pipelines evaluated on each result.
+type Operator struct {
+	// MinArgs and MaxArgs are the minimum and the maximum number of arguments.
+	MinArgs int
+	MaxArgs int
+	// Labeled operators accept arguments in the form of `label: pipeline`, where the label is an identifier
+	// or a quoted string. Arguments without labels are labeled by their (unquoted) text.
+	Labeled bool
+}
+
+var (
+	operatorsMutex sync.RWMutex
+	operators      = map[string]Operator{}
+)
+
+// RegisterOperator makes the name known to ParsePipeline as an operator, which is evaluated on all results at once
+// (such as `group_by`).
+func RegisterOperator(name string, operator Operator) {
+	operatorsMutex.Lock()
+	defer operatorsMutex.Unlock()
+
+	operators[name] = operator
+}
+
+// ResolveOperator checks the number of arguments of the operator call and parses them into Pipelines (and Labels).
+// It reports false if the call is not an operator.
+func ResolveOperator(call *Call) (bool, error) {
+	operatorsMutex.RLock()
+	operator, isOperator := operators[call.Name]
+	operatorsMutex.RUnlock()
+
+	if !isOperator {
+		return false, nil
+	} else if len(call.Args) < operator.MinArgs {
+		return true, fmt.Errorf("%s expects at least %d argument(s), got %d", call.Name, operator.MinArgs, len(call.Args))
+	} else if len(call.Args) > operator.MaxArgs {
+		return true, fmt.Errorf("%s expects at most %d argument(s), got %d", call.Name, operator.MaxArgs, len(call.Args))
+	}
+
+	pipelines := make([][]Stage, len(call.Args))
+	labels := []string{}
+	for i, arg := range call.Args {
+		if operator.Labeled {
+			label, pipeline := splitLabel(arg)
+			labels = append(labels, label)
+			arg = pipeline
+		}
+
+		stages, err := ParsePipeline(arg)
+		if err != nil {
+			return true, fmt.Errorf("argument %d of %s: %v", i+1, call.Name, err)
+		}
+		pipelines[i] = stages
+	}
+
+	call.Pipelines = pipelines
+	if operator.Labeled {
+		call.Labels = labels
+	}
+	return true, nil
+}
+
+// splitLabel splits an argument of a labeled operator into its label and its pipeline.
+// The label is separated by the first colon which is neither escaped nor quoted.
+// Arguments without labels are labeled by their text.
+func splitLabel(arg string) (string, string) {
+	runes := []rune(arg)
+	escaped := false
+	quoted := false
+
+	for i, r := range runes {
+		if escaped {
+			escaped = false
+		} else if r == quoteRune {
+			quoted = !quoted
+		} else if r == escapeRune && !quoted {
+			escaped = true
+		} else if r == labelSepRune && !quoted {
+			label := strings.TrimSpace(string(runes[:i]))
+			if ident.IsValid(label) || (len(label) >= 2 && label[0] == quoteRune && label[len(label)-1] == quoteRune) {
+				return Unquote(label), strings.TrimSpace(string(runes[i+1:]))
+			}
+			break
+		}
+	}
+
+	return arg, arg
+}
+
+// resolveCall parses the arguments of an operator or creates the function.
+func resolveCall(call *Call) error {
+	if isOperator, err := ResolveOperator(call); isOperator || err != nil {
+		return err
+	}
+
+	args := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = Unquote(arg)
+	}
+
+	fn, exists, err := functions.New(call.Name, args)
+	if !exists {
+		return fmt.Errorf("unknown operator or function: %s", call.Name)
+	} else if err != nil {
+		return err
+	}
+
+	call.Function = fn
+	return nil
+}
+
+// ParsePipeline parses a query consisting of stages separated by the pipe rune surrounded by whitespace (` | `).
+// Each stage is either a regular query or a call (operator or function). Functions are resolved,
+// so unknown names and invalid arguments are reported as errors.
+func ParsePipeline(query string) ([]Stage, error) {
+	stages := []Stage{}
+
+	for i, segment := range splitPipeline([]rune(query)) {
+		segmentStr := strings.Trim(string(segment), string(whitespaceRune))
+
+		if call, ok := ParseCall([]rune(segmentStr)); ok {
+			if err := resolveCall(call); err != nil {
+				return nil, err
+			}
+			stages = append(stages, Stage{Call: call})
+		} else if segmentStr == "" && i > 0 {
+			return nil, fmt.Errorf("empty pipeline stage at position %d", i)
+		} else if parts, err := ParseQuery(segmentStr); err != nil {
+			return nil, err
+		} else {
+			stages = append(stages, Stage{Parts: parts})
+		}
+	}
+
+	return stages, nil
+}
+
+// Dialect is a query language accepted by Parse.
+type Dialect string
+
+const (
+	// UniQueryDialect is the native query language with pipelines (see ParsePipeline).
+	UniQueryDialect Dialect = "uniquery"
+	// JSONPathDialect is RFC 9535 JSONPath (see ParseJSONPath).
+	JSONPathDialect Dialect = "jsonpath"
+)
+
+// Dialects are all dialects accepted by Parse.
+var Dialects = []Dialect{UniQueryDialect, JSONPathDialect}
+
+// Parse parses the query in the dialect. The empty dialect is UniQuery. JSONPath queries consist of a single stage.
+func Parse(query string, dialect Dialect) ([]Stage, error) {
+	switch dialect {
+	case "", UniQueryDialect:
+		return ParsePipeline(query)
+
+	case JSONPathDialect:
+		parts, err := ParseJSONPath(query)
+		if err != nil {
+			return nil, err
+		}
+		return []Stage{{Parts: parts}}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown query dialect: %s", dialect)
+	}
+}
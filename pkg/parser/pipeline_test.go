@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testTabSplitPipeline = []struct {
+	query    string
+	segments []string
+}{
+	{``, []string{``}},
+	{`a`, []string{`a`}},
+	{`a | b | c`, []string{`a `, ` b `, ` c`}},
+	{`a|b`, []string{`a|b`}},
+	{`*~^a|b`, []string{`*~^a|b`}},
+	{`*~a |b`, []string{`*~a |b`}},
+	{`*~a| b`, []string{`*~a| b`}},
+	{`"a | b" | c`, []string{`"a | b" `, ` c`}},
+	{`a\ | b`, []string{`a\ | b`}},
+	{`a \| b`, []string{`a \| b`}},
+	{`a |`, []string{`a `, ``}},
+	// Pipes within arguments of calls belong to the arguments, parentheses of regular expressions do not need to be balanced.
+	{`a | f(b | g()) | c`, []string{`a `, ` f(b | g()) `, ` c`}},
+	{`a | f(x: b~(c) | g(")")) | c`, []string{`a `, ` f(x: b~(c) | g(")")) `, ` c`}},
+	{`a~( | b`, []string{`a~( `, ` b`}},
+	{`a~x\( | b`, []string{`a~x\( `, ` b`}},
+}
+
+func TestSplitPipeline(t *testing.T) {
+	for _, entry := range testTabSplitPipeline {
+		segments := []string{}
+		for _, segment := range splitPipeline([]rune(entry.query)) {
+			segments = append(segments, string(segment))
+		}
+
+		if !cmp.Equal(segments, entry.segments) {
+			t.Errorf("Query `%s` was split into %q instead of %q", entry.query, segments, entry.segments)
+		}
+	}
+}
+
+var testTabScanCall = []struct {
+	query  string
+	name   string
+	args   []string
+	length int
+}{
+	{`upper()`, `upper`, []string{}, 7},
+	{`upper().a`, `upper`, []string{}, 7},
+	{`lt`, `lt`, []string{}, 2},
+	{`lt(5)`, `lt`, []string{`5`}, 5},
+	{`semver(">=1.2.0 <2.0.0")`, `semver`, []string{`">=1.2.0 <2.0.0"`}, 24},
+	{`replace( a , b )`, `replace`, []string{`a`, `b`}, 16},
+	{`f(,)`, `f`, []string{``, ``}, 4},
+	{`f("a,b", c\,d, "x)")`, `f`, []string{`"a,b"`, `c\,d`, `"x)"`}, 20},
+	{`count_by(a.b=c)`, `count_by`, []string{`a.b=c`}, 15},
+	{`f_1(x)`, `f_1`, []string{`x`}, 6},
+	{`f(a | g(b, c), d)`, `f`, []string{`a | g(b, c)`, `d`}, 17},
+	{`re(^(a|b)$)`, `re`, []string{`^(a|b)$`}, 11},
+}
+
+var testTabScanCallInvalid = []string{
+	``,
+	`1f()`,
+	`.f()`,
+	`f(`,
+	`f("a)`,
+	`f(a\)`,
+	`f(g()`,
+}
+
+func TestScanCall(t *testing.T) {
+	for _, entry := range testTabScanCall {
+		call, length := ScanCall([]rune(entry.query))
+		if call == nil {
+			t.Errorf("Query `%s` does not begin with a call", entry.query)
+		} else if call.Name != entry.name || !cmp.Equal(call.Args, entry.args) || length != entry.length {
+			t.Errorf("Query `%s` was scanned as %s%q (%d runes) instead of %s%q (%d runes)", entry.query, call.Name, call.Args, length, entry.name, entry.args, entry.length)
+		}
+	}
+
+	for _, query := range testTabScanCallInvalid {
+		if call, _ := ScanCall([]rune(query)); call != nil {
+			t.Errorf("Query `%s` was scanned as a call: %+v", query, call)
+		}
+	}
+}
+
+var testTabParseCall = map[string]bool{
+	`upper()`:   true,
+	`lt(5)`:     true,
+	`upper`:     false,
+	`upper().a`: false,
+	`a.b`:       false,
+	`f(`:        false,
+}
+
+func TestParseCall(t *testing.T) {
+	for query, expected := range testTabParseCall {
+		if _, ok := ParseCall([]rune(query)); ok != expected {
+			t.Errorf("Query `%s` was parsed as a call: %t", query, ok)
+		}
+	}
+}
+
+var testTabUnquote = []struct {
+	arg      string
+	unquoted string
+}{
+	{`abc`, `abc`},
+	{`"a, b"`, `a, b`},
+	{`a\,b`, `a,b`},
+	{`"a\b"`, `a\b`},
+	{`\"a\"`, `"a"`},
+	{`"a"b"c"`, `abc`},
+}
+
+func TestUnquote(t *testing.T) {
+	for _, entry := range testTabUnquote {
+		if unquoted := Unquote(entry.arg); unquoted != entry.unquoted {
+			t.Errorf("Argument `%s` was unquoted as `%s` instead of `%s`", entry.arg, unquoted, entry.unquoted)
+		}
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	RegisterOperator("test_operator", Operator{MaxArgs: 2})
+	RegisterOperator("test_labeled", Operator{MinArgs: 1, MaxArgs: 3, Labeled: true})
+
+	stages, err := ParsePipeline(`a.b | test_operator(x, y) | upper() | c`)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(stages) != 4 {
+		t.Fatalf("Unexpected number of stages: %d", len(stages))
+	}
+
+	if len(stages[0].Parts) != 2 || stages[0].Call != nil {
+		t.Errorf("Unexpected query stage: %+v", stages[0])
+	}
+	if call := stages[1].Call; call == nil || call.Name != "test_operator" || !cmp.Equal(call.Args, []string{"x", "y"}) || call.Function != nil || len(call.Pipelines) != 2 || call.Labels != nil {
+		t.Errorf("Unexpected operator stage: %+v", stages[1])
+	}
+	if call := stages[2].Call; call == nil || call.Name != "upper" || call.Function == nil {
+		t.Errorf("Unexpected function stage: %+v", stages[2])
+	}
+
+	// Arguments of labeled operators are labeled by their text, unless they have labels.
+	stages, err = ParsePipeline(`test_labeled(name, "full name": a.b | upper(), t: time~^\d+:\d+$)`)
+	if err != nil {
+		t.Fatal(err)
+	} else if call := stages[0].Call; !cmp.Equal(call.Labels, []string{"name", "full name", "t"}) || len(call.Pipelines[1]) != 2 || call.Pipelines[1][1].Call.Function == nil {
+		t.Errorf("Unexpected labeled operator stage: %+v", call)
+	}
+	if stages, err := ParsePipeline(`test_labeled(time~^\d+:\d+$)`); err != nil || !cmp.Equal(stages[0].Call.Labels, []string{`time~^\d+:\d+$`}) {
+		t.Errorf("Unexpected labels of an argument without a label: %+v (%v)", stages, err)
+	}
+
+	// An empty query has a single stage selecting the root.
+	if stages, err := ParsePipeline(``); err != nil || len(stages) != 1 || len(stages[0].Parts) != 0 {
+		t.Errorf("Unexpected stages of empty query: %+v (%v)", stages, err)
+	}
+}
+
+var testTabParsePipelineErrors = []string{
+	`a | `,
+	`a |  | b`,
+	`unknown_function()`,
+	`upper(a)`,
+	`a | .b`,
+	`a | test_operator(x, y, z)`,
+	`a | test_operator(.x)`,
+	`a | test_operator(x | unknown_function())`,
+	`a | test_labeled()`,
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	for _, query := range testTabParsePipelineErrors {
+		if _, err := ParsePipeline(query); err == nil {
+			t.Errorf("Query `%s` was expected to fail", query)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, dialect := range []Dialect{"", UniQueryDialect} {
+		if stages, err := Parse(`a | upper()`, dialect); err != nil || len(stages) != 2 {
+			t.Errorf("Unexpected stages of dialect %q: %+v (%v)", dialect, stages, err)
+		}
+	}
+
+	if stages, err := Parse(`$.a[0]`, JSONPathDialect); err != nil || len(stages) != 1 || len(stages[0].Parts) != 2 {
+		t.Errorf("Unexpected JSONPath stages: %+v (%v)", stages, err)
+	}
+
+	if _, err := Parse(`a`, Dialect("xpath")); err == nil {
+		t.Error("Unknown dialect was accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Decode stores the value of the element in the value pointed to by target. Elements of YAML documents
+// are decoded like gopkg.in/yaml.v3 decodes documents (using yaml tags), other elements like encoding/json does
+// (using json tags). Targets with json tags only (such as types shared with JSON APIs) are decoded
+// like encoding/json does even from YAML documents. An error describing the element is returned
+// if the value does not fit the target.
+func (e Element) Decode(target interface{}) error {
+	value := e.Value
+	if _, isNode := value.(Node); isNode {
+		value = Plain(value)
+	}
+
+	asYAML := e.Node != nil
+	if asYAML && hasJSONTagsOnly(reflect.TypeOf(target), map[reflect.Type]bool{}) {
+		// Keys of YAML maps may be other than strings, which encoding/json does not support.
+		asYAML = false
+		value = Plain(value)
+	}
+
+	var err error
+	if asYAML {
+		node := yaml.Node{}
+		if err = node.Encode(value); err == nil {
+			err = node.Decode(target)
+		}
+	} else {
+		var data []byte
+		if data, err = json.Marshal(value); err == nil {
+			err = json.NewDecoder(bytes.NewReader(data)).Decode(target)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to decode result %s: %w", e.describe(), err)
+	}
+	return nil
+}
+
+// hasJSONTagsOnly returns true if the type has struct fields (at any depth) with json tags, but without yaml tags.
+func hasJSONTagsOnly(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == nil || seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return hasJSONTagsOnly(t.Elem(), seen)
+
+	case reflect.Map:
+		return hasJSONTagsOnly(t.Key(), seen) || hasJSONTagsOnly(t.Elem(), seen)
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if _, hasYAML := f.Tag.Lookup("yaml"); !hasYAML {
+				if _, hasJSON := f.Tag.Lookup("json"); hasJSON {
+					return true
+				}
+			}
+			if hasJSONTagsOnly(f.Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// describe returns the full path of the element for error messages.
+func (e Element) describe() string {
+	if path := e.GetFullPath(); path != "" {
+		return "`" + path + "`"
+	}
+	return "root element"
+}
+
+// Decode stores the results in document order in the slice pointed to by target.
+// Otherwise, there must be exactly one result, which is stored in the value pointed to by target.
+// Use Element.Decode to decode a single result which is an array.
+func Decode(results map[string]Element, target interface{}) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return fmt.Errorf("decoding target must be a non-nil pointer, got %T", target)
+	}
+
+	slice := targetValue.Elem()
+	if slice.Kind() != reflect.Slice {
+		if len(results) != 1 {
+			return fmt.Errorf("expected exactly one result, got %d", len(results))
+		}
+		for _, e := range results {
+			return e.Decode(target)
+		}
+	}
+
+	decoded := reflect.MakeSlice(slice.Type(), len(results), len(results))
+	for i, e := range Sorted(results) {
+		if err := e.Decode(decoded.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	slice.Set(decoded)
+	return nil
+}
+
+// DecodeOne stores the only result in the value pointed to by target (see Element.Decode).
+// It fails if there is not exactly one result.
+func DecodeOne(results map[string]Element, target interface{}) error {
+	if len(results) != 1 {
+		return fmt.Errorf("query has %d results instead of exactly one", len(results))
+	}
+
+	for _, e := range results {
+		return e.Decode(target)
+	}
+	return nil
+}
+
+// DecodeAll stores the results in document order in the slice pointed to by target.
+func DecodeAll(results map[string]Element, target interface{}) error {
+	if targetValue := reflect.ValueOf(target); targetValue.Kind() != reflect.Ptr || targetValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("decoding target must be a pointer to a slice, got %T", target)
+	}
+	return Decode(results, target)
+}
+
+// QueryOne evaluates the query and stores its only result in the value pointed to by target.
+// It fails if the query does not have exactly one result.
+func (r *Runner) QueryOne(query string, root interface{}, target interface{}) error {
+	results, err := r.Run(query, root)
+	if err != nil {
+		return err
+	}
+	return DecodeOne(results, target)
+}
+
+// QueryAll evaluates the query and stores its results in document order in the slice pointed to by target.
+func (r *Runner) QueryAll(query string, root interface{}, target interface{}) error {
+	results, err := r.Run(query, root)
+	if err != nil {
+		return err
+	}
+	return DecodeAll(results, target)
+}
+
+func QueryOne(query string, root interface{}, target interface{}) error {
+	return defaultRunner.QueryOne(query, root, target)
+}
+
+func QueryAll(query string, root interface{}, target interface{}) error {
+	return defaultRunner.QueryAll(query, root, target)
+}
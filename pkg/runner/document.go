@@ -0,0 +1,181 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/natiiix/uniquery/pkg/ordered"
+)
+
+// Position is the location of a value in the source of its document.
+type Position struct {
+	// Line and Column start at 1. Columns are counted in characters.
+	Line   int
+	Column int
+	// Offset is the number of bytes preceding the value.
+	Offset int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Document is a decoded document. In addition to the decoded value, it keeps the positions of values
+// in the source and, for YAML documents, the node tree, so that modified documents can be written
+// with their comments, anchors, key order and scalar styles intact.
+// Documents can be used as root values in queries (where they behave as the decoded value) and modifications.
+type Document struct {
+	Root interface{}
+	// Node is the YAML node tree, if the document has been decoded from YAML.
+	Node *yaml.Node
+	// stream is set for YAML streams of multiple documents, whose node is a sequence of document nodes.
+	stream bool
+	// yamlMappings index the keys of the mapping nodes in the node tree.
+	yamlMappings map[*yaml.Node]*yamlMapping
+
+	source []byte
+	// lines contains the offsets at which the lines of the source begin.
+	lines []int
+	// skippedLines and skippedBytes precede the source in its stream, such as the preceding records of JSON Lines.
+	skippedLines int
+	skippedBytes int
+	// offsets of values, for documents without a node tree.
+	offsets *valueOffsets
+}
+
+// valueOffsets are the byte offsets of values in the source of a JSON document. Offsets of children are kept
+// by their container, which is identified by the pointer of its map or of its first item (see containerPointer),
+// so that neither paths nor positions have to be stored for every value.
+type valueOffsets struct {
+	root    int
+	members map[uintptr]map[string]int
+	items   map[uintptr][]int
+}
+
+// containerPointer identifies a decoded object or a non-empty array.
+func containerPointer(value interface{}) (uintptr, bool) {
+	switch value.(type) {
+	case map[string]interface{}, *ordered.Map:
+		return reflect.ValueOf(value).Pointer(), true
+
+	case []interface{}:
+		v := reflect.ValueOf(value)
+		return v.Pointer(), v.Len() > 0
+
+	default:
+		return 0, false
+	}
+}
+
+// offset returns the offset of the element, which is the root or a child of a decoded container.
+func (o *valueOffsets) offset(e Element) (int, bool) {
+	if e.Parent == nil {
+		return o.root, true
+	}
+
+	pointer, ok := containerPointer(e.Parent.Value)
+	if !ok {
+		return 0, false
+	}
+
+	switch key := e.Key.(type) {
+	case string:
+		offset, ok := o.members[pointer][key]
+		return offset, ok
+
+	case int:
+		items := o.items[pointer]
+		if key < 0 || key >= len(items) {
+			return 0, false
+		}
+		return items[key], true
+
+	default:
+		return 0, false
+	}
+}
+
+func newDocument(source []byte) *Document {
+	lines := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+
+	return &Document{source: source, lines: lines}
+}
+
+// MarshalJSON encodes the decoded value, so that documents can be encoded like any other value.
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Root)
+}
+
+// offsetPosition returns the position at the byte offset.
+func (d *Document) offsetPosition(offset int) Position {
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	column := utf8.RuneCount(d.source[d.lines[line]:offset]) + 1
+	return Position{Line: d.skippedLines + line + 1, Column: column, Offset: d.skippedBytes + offset}
+}
+
+// linePosition returns the position at the line and column (in characters), as reported by the YAML parser.
+func (d *Document) linePosition(line int, column int) Position {
+	if line < 1 || line > len(d.lines) {
+		return Position{Line: line, Column: column, Offset: -1}
+	}
+
+	offset := d.lines[line-1]
+	for i := 1; i < column && offset < len(d.source); i++ {
+		_, size := utf8.DecodeRune(d.source[offset:])
+		offset += size
+	}
+	return Position{Line: line, Column: column, Offset: offset}
+}
+
+// Position returns the position of the element in the source of its document. Members of mappings
+// are located at their keys, other values at their first character. The position is unknown
+// for elements which do not come from a decoded document or which have been created by operators.
+func (e Element) Position() (Position, bool) {
+	if e.doc == nil {
+		return Position{}, false
+	}
+
+	if e.doc.Node == nil {
+		if e.doc.offsets == nil {
+			return Position{}, false
+		}
+		offset, ok := e.doc.offsets.offset(e)
+		if !ok {
+			return Position{}, false
+		}
+		return e.doc.offsetPosition(offset), true
+	}
+
+	node := e.Node
+	if e.Parent != nil && e.Parent.Node != nil {
+		if parent := resolveYamlNode(e.Parent.Node); parent != nil && parent.Kind == yaml.MappingNode {
+			if keyNode, _ := e.doc.yamlMappingEntry(parent, e.Key); keyNode != nil {
+				node = keyNode
+			}
+		}
+	}
+	node = resolveDocumentNode(node)
+
+	if node == nil || node.Line == 0 {
+		return Position{}, false
+	}
+	return e.doc.linePosition(node.Line, node.Column), true
+}
+
+// resolveDocumentNode skips the document node, whose position is not the position of its content.
+func resolveDocumentNode(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		return node.Content[0]
+	}
+	return node
+}
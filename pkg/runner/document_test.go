@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+const positionsYAML string = `# Services
+services:
+  web:
+    image: "nginx"
+    ports: [80, 443]
+  db: &db
+    image: postgres
+  replica:
+    <<: *db
+`
+
+const positionsJSON string = `{
+    "name": "uniquery",
+    "tags": ["go", "čeština"],
+    "nested": {"value": null}
+}`
+
+var testTabPositions = []struct {
+	query     string
+	source    string
+	decode    func(io.Reader) (interface{}, error)
+	positions []string
+}{
+	{`services`, positionsYAML, DecodeYaml, []string{`"services" 2:1`}},
+	{`services.web.image`, positionsYAML, DecodeYaml, []string{`"services"."web"."image" 4:5`}},
+	{`services.web.ports.*`, positionsYAML, DecodeYaml, []string{`"services"."web"."ports".0 5:13`, `"services"."web"."ports".1 5:17`}},
+	{`services.replica.image`, positionsYAML, DecodeYaml, []string{`"services"."replica"."image" 7:5`}},
+	{``, positionsJSON, DecodeJson, []string{` 1:1`}},
+	{`name`, positionsJSON, DecodeJson, []string{`"name" 2:5`}},
+	{`tags.*`, positionsJSON, DecodeJson, []string{`"tags".0 3:14`, `"tags".1 3:20`}},
+	{`nested.value`, positionsJSON, DecodeJson, []string{`"nested"."value" 4:16`}},
+	{`*`, positionsJSON, DecodeJson, []string{`"name" 2:5`, `"tags" 3:5`, `"nested" 4:5`}},
+	// Results of functions keep the positions of the original elements.
+	{`name | upper()`, positionsJSON, DecodeJson, []string{`"name" 2:5`}},
+}
+
+func TestPositions(t *testing.T) {
+	for index, entry := range testTabPositions {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			doc, err := entry.decode(strings.NewReader(entry.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := Run(entry.query, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			positions := []string{}
+			for _, e := range Sorted(results) {
+				position, ok := e.Position()
+				if !ok {
+					t.Fatalf("Unknown position of %s", e.GetFullPath())
+				}
+				positions = append(positions, fmt.Sprintf("%s %v", e.GetFullPath(), position))
+			}
+
+			if !cmp.Equal(positions, entry.positions) {
+				t.Errorf("Unexpected positions of query `%s` results: %v instead of %v", entry.query, positions, entry.positions)
+			}
+		})
+	}
+
+	// Offsets are counted in bytes.
+	doc, err := DecodeJson(strings.NewReader(positionsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Run(`tags.1`, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range results {
+		if position, _ := e.Position(); positionsJSON[position.Offset:position.Offset+3] != `"č` {
+			t.Errorf("Unexpected offset %d of %s", position.Offset, e.GetFullPath())
+		}
+	}
+}
+
+func TestModifiedYAMLNodes(t *testing.T) {
+	doc, err := DecodeYaml(strings.NewReader(positionsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The merged key is overridden by a key added to the mapping, which is found by later queries.
+	if _, err := Set(doc, `services.replica.image`, "mysql"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Delete(doc, `services.web.ports`); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Run(`services.**`, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := []string{}
+	for _, e := range Sorted(results) {
+		if e.Node == nil {
+			t.Fatalf("Unknown node of %s", e.GetFullPath())
+		}
+		if e.Node.Kind == yaml.ScalarNode {
+			nodes = append(nodes, fmt.Sprintf("%s %s", e.GetFullPath(), e.Node.Value))
+		}
+	}
+
+	expected := []string{`"services"."web"."image" nginx`, `"services"."db"."image" postgres`, `"services"."replica"."image" mysql`}
+	if !cmp.Equal(nodes, expected) {
+		t.Errorf("Unexpected nodes of the modified document: %v instead of %v", nodes, expected)
+	}
+}
@@ -2,9 +2,10 @@ package runner
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
+	"gopkg.in/yaml.v3"
+
 	"github.com/natiiix/uniquery/pkg/filters"
 	"github.com/natiiix/uniquery/pkg/parser"
 )
@@ -13,63 +14,65 @@ type Element struct {
 	Value  interface{}
 	Parent *Element
 	Key    interface{}
+	// Node is the YAML node of the element, if it comes from a YAML document.
+	Node *yaml.Node
+
+	// doc is the decoded document containing the element, used to find its position.
+	doc *Document
+	// source is the node which the element was created from, unless it is an element of a decoded value.
+	source Node
 }
 
 func (e Element) GetChildren() map[string]Element {
-	switch t := e.Value.(type) {
-	case map[string]interface{}:
-		children := map[string]Element{}
-		for k, v := range t {
-			elem := NewElement(v, &e, k)
-			children[elem.GetFullPath()] = elem
-		}
-		return children
-
-	case map[interface{}]interface{}:
-		children := map[string]Element{}
-		for k, v := range t {
-			elem := NewElement(v, &e, k)
-			children[elem.GetFullPath()] = elem
-		}
-		return children
-
-	case []interface{}:
-		children := map[string]Element{}
-		for k, v := range t {
-			elem := NewElement(v, &e, k)
-			children[elem.GetFullPath()] = elem
-		}
-		return children
-
-	default:
-		return map[string]Element{}
+	children := map[string]Element{}
+	for _, child := range e.node().Children() {
+		elem := e.childElement(child)
+		children[elem.GetFullPath()] = elem
 	}
+	return children
 }
 
 func (e Element) GetChildrenRecursive() map[string]Element {
+	children, _ := e.childrenRecursive(unlimited())
+	return children
+}
+
+func (e Element) childrenRecursive(eval *evaluation) (map[string]Element, error) {
 	// NOTE: Includes the element itself
 
-	children := e.ToMap()
+	children := map[string]Element{}
+	err := e.eachDescendant(eval, func(elem Element) error {
+		children[elem.GetFullPath()] = elem
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
 
-	for k1, v1 := range e.GetChildren() {
-		children[k1] = v1
+// eachDescendant calls the function on the element itself and on each of its descendants as they are visited,
+// so that the evaluation stops as soon as the function or a limit fails.
+func (e Element) eachDescendant(eval *evaluation, fn func(elem Element) error) error {
+	if err := fn(e); err != nil {
+		return err
+	}
 
-		for k2, v2 := range v1.GetChildrenRecursive() {
-			children[k2] = v2
+	for _, child := range e.GetChildren() {
+		if err := eval.visit(child); err != nil {
+			return err
+		}
+		if err := child.eachDescendant(eval, fn); err != nil {
+			return err
 		}
 	}
 
-	return children
+	return nil
 }
 
 func (e Element) MatchesFilters(valueFilters []filters.Filter) bool {
-	for _, f := range valueFilters {
-		if !f.IsMatch(e.Value) {
-			return false
-		}
-	}
-
-	return true
+	match, _ := e.matchesFilters(unlimited(), valueFilters)
+	return match
 }
 
 func (e Element) GetFullPath() string {
@@ -100,10 +103,28 @@ func NewElement(value interface{}, parent *Element, key interface{}) Element {
 	}
 }
 
+// NewElementRoot creates the root element. Documents are unwrapped, so that the root element
+// has the decoded value and its children know their positions and YAML nodes.
 func NewElementRoot(value interface{}) Element {
+	if doc, ok := value.(*Document); ok {
+		root := NewElement(doc.Root, nil, nil)
+		root.Node = doc.Node
+		root.doc = doc
+		return root
+	}
+
 	return NewElement(value, nil, nil)
 }
 
+func (e *Element) newChild(value interface{}, key interface{}) Element {
+	child := NewElement(value, e, key)
+	child.doc = e.doc
+	if e.Node != nil {
+		child.Node = e.doc.yamlChildNode(e.Node, key)
+	}
+	return child
+}
+
 func compareKey(key interface{}, specifier string) bool {
 	switch t := key.(type) {
 	case string:
@@ -122,52 +143,75 @@ func compareKey(key interface{}, specifier string) bool {
 	}
 }
 
+// Query evaluates the query parts on the element. The evaluation is not limited (see RunPipelineContext).
 func (e Element) Query(parts []parser.QueryPart) map[string]Element {
+	results, _ := e.query(unlimited(), parts)
+	return results
+}
+
+func (e Element) query(eval *evaluation, parts []parser.QueryPart) (map[string]Element, error) {
 	if len(parts) == 0 {
-		return e.ToMap()
+		return e.ToMap(), eval.addResult(e)
 	}
 
 	part := parts[0]
 	subquery := parts[1:]
 
-	selected := map[string]Element{}
-	spec := part.Specifier
+	results := map[string]Element{}
+	// add evaluates the rest of the query on a selected element, as soon as it is selected.
+	add := func(elem Element) error {
+		if match, err := elem.matchesFilters(eval, part.Filters); err != nil || !match {
+			return err
+		}
 
-	if spec == "" && e.Parent != nil {
-		selected = e.Parent.ToMap()
-	} else if spec == "*" {
-		selected = e.GetChildren()
-	} else if spec == "**" {
-		selected = e.GetChildrenRecursive()
-	} else {
-		switch t := e.Value.(type) {
-		case map[string]interface{}:
-			if child, exists := t[spec]; exists {
-				selected = NewElement(child, &e, spec).ToMap()
-			}
+		subresults, err := elem.query(eval, subquery)
+		if err != nil {
+			return err
+		}
+		for k, v := range subresults {
+			results[k] = v
+		}
+		return nil
+	}
 
-		case map[interface{}]interface{}:
-			for k, v := range t {
-				if compareKey(k, spec) {
-					elem := NewElement(v, &e, k)
-					selected[elem.GetFullPath()] = elem
-				}
+	if len(part.Selectors) > 0 {
+		selected, err := e.selectChildren(eval, part.Selectors)
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range selected {
+			if err := add(elem); err != nil {
+				return nil, err
 			}
-
-		case []interface{}:
-			if index, err := strconv.Atoi(spec); err == nil && (index >= 0 && index < len(t)) {
-				selected = NewElement(t[index], &e, index).ToMap()
+		}
+	} else if part.IsParent() && e.Parent != nil {
+		if err := add(*e.Parent); err != nil {
+			return nil, err
+		}
+	} else if part.IsWildcard() {
+		for _, child := range e.GetChildren() {
+			if err := eval.visit(child); err != nil {
+				return nil, err
+			}
+			if err := add(child); err != nil {
+				return nil, err
 			}
 		}
-	}
-
-	results := map[string]Element{}
-	for _, e := range selected {
-		if e.MatchesFilters(part.Filters) {
-			for k, v := range e.Query(subquery) {
-				results[k] = v
+	} else if part.IsRecursive() {
+		if err := e.eachDescendant(eval, add); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, child := range e.node().Lookup(part.Specifier) {
+			elem := e.childElement(child)
+			if err := eval.visit(elem); err != nil {
+				return nil, err
+			}
+			if err := add(elem); err != nil {
+				return nil, err
 			}
 		}
 	}
-	return results
+
+	return results, nil
 }
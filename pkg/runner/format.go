@@ -0,0 +1,255 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Format is a data representation format, which documents can be decoded from and encoded to.
+// Formats are registered by RegisterFormat, so that files are recognized by their extensions or content.
+type Format interface {
+	// Name is the lowercase name of the format, such as "json".
+	Name() string
+	// Extensions are the file extensions of the format including the dot, such as ".yml".
+	Extensions() []string
+	// Sniff checks whether the beginning of a file looks like a document in the format.
+	Sniff(head []byte) bool
+	// Decode decodes a document. It may return a *Document to provide positions of its values.
+	Decode(r io.Reader) (interface{}, error)
+	// Encode encodes the value (or a *Document returned by Decode).
+	Encode(w io.Writer, value interface{}) error
+}
+
+// runnerEncoder is implemented by built-in formats, which are encoded according to the options of the runner.
+type runnerEncoder interface {
+	encode(r *Runner, w io.Writer, value interface{}) error
+}
+
+// runnerDecoder is implemented by built-in formats, which are decoded according to the options of the runner.
+type runnerDecoder interface {
+	decode(r *Runner, reader io.Reader) (interface{}, error)
+}
+
+// sniffLength is the length of the beginning of a file passed to Format.Sniff.
+const sniffLength = 512
+
+var (
+	formatsMutex sync.RWMutex
+	formats      = []Format{}
+)
+
+func init() {
+	RegisterFormat(JsonFormat)
+	RegisterFormat(YamlFormat)
+}
+
+// RegisterFormat makes the format available to FormatByName, DetectFormat and the command-line interface.
+// Formats are sniffed in the order of their registration. It panics if a format of the same name is already registered.
+func RegisterFormat(f Format) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+
+	for _, registered := range formats {
+		if registered.Name() == f.Name() {
+			panic("runner: format " + f.Name() + " is already registered")
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats in the order of their registration.
+func Formats() []Format {
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+
+	return append([]Format{}, formats...)
+}
+
+// FormatByName returns the registered format of the name.
+func FormatByName(name string) (Format, bool) {
+	for _, f := range Formats() {
+		if f.Name() == strings.ToLower(name) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// FormatByExtension returns the registered format of the extension of the path.
+func FormatByExtension(path string) (Format, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range Formats() {
+		for _, formatExt := range f.Extensions() {
+			if ext != "" && ext == formatExt {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DetectFormat determines the format of a file by its extension or, if it is not known, by the beginning of its content.
+func DetectFormat(path string, head []byte) (Format, bool) {
+	if f, ok := FormatByExtension(path); ok {
+		return f, true
+	}
+
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	for _, f := range Formats() {
+		if f.Sniff(head) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Encode encodes the value in the format. Built-in formats use the indentation of the runner.
+func (r *Runner) Encode(f Format, w io.Writer, value interface{}) error {
+	if encoder, ok := f.(runnerEncoder); ok {
+		return encoder.encode(r, w, value)
+	}
+	return f.Encode(w, value)
+}
+
+// Decode decodes a document in the format. Built-in formats use the options of the runner (see Options.PlainJSON).
+func (r *Runner) Decode(f Format, reader io.Reader) (interface{}, error) {
+	if decoder, ok := f.(runnerDecoder); ok {
+		return decoder.decode(r, reader)
+	}
+	return f.Decode(reader)
+}
+
+// RunFormat decodes a document in the format and evaluates the query on it.
+func (r *Runner) RunFormat(query string, f Format, reader io.Reader) (map[string]Element, error) {
+	root, err := r.Decode(f, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Run(query, root)
+}
+
+// RunFile evaluates the query on a file, whose format is detected by DetectFormat.
+func (r *Runner) RunFile(query string, path string) (map[string]Element, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, sniffLength)
+	head, _ := reader.Peek(sniffLength)
+
+	f, ok := DetectFormat(path, head)
+	if !ok {
+		return nil, fmt.Errorf("unknown format of %s", path)
+	}
+	return r.RunFormat(query, f, reader)
+}
+
+func RunFormat(query string, f Format, reader io.Reader) (map[string]Element, error) {
+	return defaultRunner.RunFormat(query, f, reader)
+}
+
+func RunFile(query string, path string) (map[string]Element, error) {
+	return defaultRunner.RunFile(query, path)
+}
+
+// trimHead removes the byte order mark, whitespace and (if the format allows them) comments from the beginning of a file.
+func trimHead(head []byte, comments bool) []byte {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	for {
+		head = bytes.TrimLeft(head, " \t\r\n")
+		if !comments || !bytes.HasPrefix(head, []byte("#")) {
+			return head
+		} else if newline := bytes.IndexByte(head, '\n'); newline >= 0 {
+			head = head[newline+1:]
+		} else {
+			return nil
+		}
+	}
+}
+
+type jsonFormat struct{}
+
+// JsonFormat is the registered JSON format.
+var JsonFormat Format = jsonFormat{}
+
+func (jsonFormat) Name() string {
+	return "json"
+}
+
+func (jsonFormat) Extensions() []string {
+	return []string{".json"}
+}
+
+func (jsonFormat) Sniff(head []byte) bool {
+	head = trimHead(head, false)
+	return len(head) > 0 && (head[0] == '{' || head[0] == '[')
+}
+
+func (jsonFormat) Decode(r io.Reader) (interface{}, error) {
+	return DecodeJson(r)
+}
+
+func (jsonFormat) decode(r *Runner, reader io.Reader) (interface{}, error) {
+	return r.DecodeJson(reader)
+}
+
+func (jsonFormat) Encode(w io.Writer, value interface{}) error {
+	return EncodeJson(w, value)
+}
+
+func (jsonFormat) encode(r *Runner, w io.Writer, value interface{}) error {
+	return r.EncodeJson(w, value)
+}
+
+type yamlFormat struct{}
+
+// YamlFormat is the registered YAML format.
+var YamlFormat Format = yamlFormat{}
+
+// yamlHeadRegex matches the usual beginnings of YAML documents: directives, document markers,
+// sequence items and mapping keys.
+var yamlHeadRegex = regexp.MustCompile(`^(%YAML|---|- |-$|[^\s:{}\[\],#]+:(\s|$))`)
+
+func (yamlFormat) Name() string {
+	return "yaml"
+}
+
+func (yamlFormat) Extensions() []string {
+	return []string{".yaml", ".yml"}
+}
+
+func (yamlFormat) Sniff(head []byte) bool {
+	head = trimHead(head, true)
+	if newline := bytes.IndexByte(head, '\n'); newline >= 0 {
+		head = head[:newline]
+	}
+	return yamlHeadRegex.Match(bytes.TrimRight(head, "\r"))
+}
+
+func (yamlFormat) Decode(r io.Reader) (interface{}, error) {
+	return DecodeYaml(r)
+}
+
+func (yamlFormat) decode(r *Runner, reader io.Reader) (interface{}, error) {
+	return r.DecodeYaml(reader)
+}
+
+func (yamlFormat) Encode(w io.Writer, value interface{}) error {
+	return EncodeYaml(w, value)
+}
+
+func (yamlFormat) encode(r *Runner, w io.Writer, value interface{}) error {
+	return r.EncodeYaml(w, value)
+}
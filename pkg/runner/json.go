@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/natiiix/uniquery/pkg/ordered"
+)
+
+// jsonDecoder reads values from the token stream. Values are decoded into the types produced by encoding/json
+// or, if exact is true, objects are decoded as ordered maps, so that their keys keep the document order,
+// and numbers as json.Number. Positions of values are recorded in the document, if there is one.
+type jsonDecoder struct {
+	decoder *json.Decoder
+	doc     *Document
+	exact   bool
+}
+
+// tokenOffset returns the offset of the next token, skipping whitespace and separators.
+func (d *jsonDecoder) tokenOffset() int {
+	if d.doc == nil {
+		return 0
+	}
+
+	offset := int(d.decoder.InputOffset())
+	for offset < len(d.doc.source) {
+		switch d.doc.source[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+func (d *jsonDecoder) decodeValue() (interface{}, error) {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeToken(token)
+}
+
+// decodeToken decodes the value beginning with the token, which has already been read.
+func (d *jsonDecoder) decodeToken(token json.Token) (interface{}, error) {
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			object := ordered.NewMap()
+			offsets := map[string]int{}
+			for d.decoder.More() {
+				// Object members are located at their keys.
+				offset := d.tokenOffset()
+				keyToken, err := d.decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				key, ok := keyToken.(string)
+				if !ok {
+					return nil, fmt.Errorf("unexpected JSON object key: %v", keyToken)
+				}
+				offsets[key] = offset
+
+				value, err := d.decodeValue()
+				if err != nil {
+					return nil, err
+				}
+				object.Set(key, value)
+			}
+			// Closing brace.
+			if _, err := d.decoder.Token(); err != nil {
+				return nil, err
+			}
+
+			var result interface{} = object
+			if !d.exact {
+				result = object.ToMap()
+			}
+			if pointer, ok := containerPointer(result); ok && d.doc != nil {
+				d.doc.offsets.members[pointer] = offsets
+			}
+			return result, nil
+
+		case '[':
+			array := []interface{}{}
+			offsets := []int{}
+			for d.decoder.More() {
+				offsets = append(offsets, d.tokenOffset())
+
+				value, err := d.decodeValue()
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+			// Closing bracket.
+			if _, err := d.decoder.Token(); err != nil {
+				return nil, err
+			}
+
+			if pointer, ok := containerPointer(array); ok && d.doc != nil {
+				d.doc.offsets.items[pointer] = offsets
+			}
+			return array, nil
+
+		default:
+			return nil, fmt.Errorf("unexpected JSON delimiter: %v", t)
+		}
+
+	case json.Number:
+		if !d.exact {
+			return t.Float64()
+		}
+		return t, nil
+
+	default:
+		return token, nil
+	}
+}
+
+// DecodeJson decodes a single JSON value. Objects keep the order of their keys and numbers keep their literals,
+// unless the runner has the PlainJSON option, which decodes values into the same types as encoding/json.
+// The returned value is a *Document, which can be queried like the decoded value (see Document.Root)
+// and which knows the positions of its values.
+func (r *Runner) DecodeJson(reader io.Reader) (interface{}, error) {
+	source, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJsonSource(source, !r.options.PlainJSON)
+}
+
+func DecodeJson(r io.Reader) (interface{}, error) {
+	return defaultRunner.DecodeJson(r)
+}
+
+// decodeJsonSource decodes the JSON value in the source into a document.
+func decodeJsonSource(source []byte, exact bool) (*Document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+	doc := newDocument(source)
+	doc.offsets = &valueOffsets{members: map[uintptr]map[string]int{}, items: map[uintptr][]int{}}
+	d := &jsonDecoder{decoder: decoder, doc: doc, exact: exact}
+
+	doc.offsets.root = d.tokenOffset()
+	root, err := d.decodeValue()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level JSON value")
+	}
+
+	d.doc.Root = root
+	return d.doc, nil
+}
+
+func (r *Runner) EncodeJson(w io.Writer, root interface{}) error {
+	indent := r.options.Indent
+	if indent == 0 {
+		indent = 4
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", strings.Repeat(" ", indent))
+	// Documents are written back to their files, which should not have `<`, `>` and `&` rewritten as escapes.
+	encoder.SetEscapeHTML(false)
+	if doc, ok := root.(*Document); ok {
+		root = doc.Root
+	}
+	return encoder.Encode(root)
+}
+
+func EncodeJson(w io.Writer, root interface{}) error {
+	return defaultRunner.EncodeJson(w, root)
+}
+
+// Plain converts values to the types produced by encoding/json, so that they can be used
+// with code which does not know about ordered maps. Numbers are converted to float64,
+// which may lose precision. Nodes and maps with keys other than strings (such as YAML 1.1 booleans)
+// are copied into maps with string keys and arrays.
+func Plain(value interface{}) interface{} {
+	switch t := value.(type) {
+	case *ordered.Map:
+		result := make(map[string]interface{}, t.Len())
+		for _, key := range t.Keys() {
+			child, _ := t.Get(key)
+			result[key] = Plain(child)
+		}
+		return result
+
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			result[k] = Plain(v)
+		}
+		return result
+
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			result[fmt.Sprintf("%v", k)] = Plain(v)
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, v := range t {
+			result[i] = Plain(v)
+		}
+		return result
+
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return value
+
+	case Node:
+		switch t.Kind() {
+		case MappingNode:
+			result := map[string]interface{}{}
+			for _, child := range t.Children() {
+				result[fmt.Sprintf("%v", child.Key())] = Plain(child)
+			}
+			return result
+
+		case SequenceNode:
+			result := []interface{}{}
+			for _, child := range t.Children() {
+				result = append(result, Plain(child))
+			}
+			return result
+
+		default:
+			return Plain(t.Value())
+		}
+
+	default:
+		return value
+	}
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const numbersJSON string = `{
+	"id": 9007199254740993,
+	"other": 9007199254740992,
+	"price": 10.50,
+	"ratio": 1e-3,
+	"text": "9007199254740993"
+}`
+
+// Numbers are decoded as json.Number by default, so they keep their precision and their original text.
+var testTabJSONNumberPrecision = testTab{
+	{`*=9007199254740993`, numbersJSON, map[string]interface{}{`"id"`: json.Number("9007199254740993"), `"text"`: "9007199254740993"}},
+	{`*=9007199254740992`, numbersJSON, map[string]interface{}{`"other"`: json.Number("9007199254740992")}},
+	{`*="10.5"`, numbersJSON, map[string]interface{}{`"price"`: json.Number("10.50")}},
+	{`*="0.001"`, numbersJSON, map[string]interface{}{`"ratio"`: json.Number("1e-3")}},
+	{`*@gt(9007199254740992)`, numbersJSON, map[string]interface{}{`"id"`: json.Number("9007199254740993")}},
+	{`*@ge(9007199254740992)`, numbersJSON, map[string]interface{}{`"id"`: json.Number("9007199254740993"), `"other"`: json.Number("9007199254740992")}},
+	{`*@lt(1)`, numbersJSON, map[string]interface{}{`"ratio"`: json.Number("1e-3")}},
+	{`*@le(10.5)`, numbersJSON, map[string]interface{}{`"price"`: json.Number("10.50"), `"ratio"`: json.Number("1e-3")}},
+}
+
+func TestJSONNumberPrecision(t *testing.T) {
+	runTests(t, testTabJSONNumberPrecision, true, RunJsonString)
+
+	root, err := DecodeJson(strings.NewReader(numbersJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := strings.Builder{}
+	if err := json.NewEncoder(&sb).Encode(root); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `{"id":9007199254740993,"other":9007199254740992,"price":10.50,"ratio":1e-3,"text":"9007199254740993"}` + "\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected JSON output: %s instead of %s", sb.String(), expected)
+	}
+}
+
+func TestDefaultJSONNumbers(t *testing.T) {
+	const source = `{"id": 9007199254740993}`
+
+	// The default runner does not round the number to the nearest float64 (9007199254740992).
+	if results, err := RunJsonString(`id=9007199254740992`, source); err != nil || len(results) != 0 {
+		t.Errorf("Rounded number matched: %v (%v)", results, err)
+	}
+
+	results, err := RunJsonString(`id=9007199254740993`, source)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+
+	sb := strings.Builder{}
+	if err := EncodeJson(&sb, results[`"id"`].Value); err != nil {
+		t.Fatal(err)
+	} else if sb.String() != "9007199254740993\n" {
+		t.Errorf("Unexpected JSON output: %s", sb.String())
+	}
+
+	// Plain numbers are float64, so they are rounded.
+	if results, err := plainRunner.RunJsonString(`id=9007199254740992`, source); err != nil || len(results) != 1 {
+		t.Errorf("Unexpected results of plain numbers: %v (%v)", results, err)
+	}
+}
+
+func TestJSONKeyOrder(t *testing.T) {
+	const source = `{"z": 1, "a": {"y": 2, "b": 3}, "m": [{"d": 4, "c": 5}]}`
+
+	doc, err := DecodeJson(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := Set(doc, `a.y`, "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := strings.Builder{}
+	if err := json.NewEncoder(&sb).Encode(root); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `{"z":1,"a":{"y":"changed","b":3},"m":[{"d":4,"c":5}]}` + "\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected JSON output: %s instead of %s", sb.String(), expected)
+	}
+}
+
+func TestEncodeJsonHTML(t *testing.T) {
+	const source = `{"<a href=\"x\">": "Tom & Jerry", "list": [">"]}`
+
+	doc, err := DecodeJson(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := strings.Builder{}
+	if err := NewRunner(Options{Indent: 1}).EncodeJson(&sb, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = "{\n \"<a href=\\\"x\\\">\": \"Tom & Jerry\",\n \"list\": [\n  \">\"\n ]\n}\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected JSON output: %q instead of %q", sb.String(), expected)
+	}
+}
@@ -0,0 +1,214 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+	"github.com/natiiix/uniquery/pkg/parser"
+)
+
+// selectChildren selects the children of the element by the selectors of a JSONPath segment.
+// Names select only members of mappings, indices and slices only items of sequences.
+// Children are in the order of the selectors, those selected by multiple selectors are repeated.
+func (e Element) selectChildren(eval *evaluation, selectors []parser.Selector) ([]Element, error) {
+	node := e.node()
+	kind := node.Kind()
+	selected := []Element{}
+
+	for _, selector := range selectors {
+		children := []Node{}
+
+		switch s := selector.(type) {
+		case parser.NameSelector:
+			if kind == MappingNode {
+				children = append(children, node.Lookup(s.Name)...)
+			}
+
+		case parser.IndexSelector:
+			if kind == SequenceNode {
+				all := node.Children()
+				if i, ok := s.Position(len(all)); ok {
+					children = append(children, all[i])
+				}
+			}
+
+		case parser.SliceSelector:
+			if kind == SequenceNode {
+				all := node.Children()
+				for _, i := range s.Positions(len(all)) {
+					children = append(children, all[i])
+				}
+			}
+
+		case parser.WildcardSelector, parser.FilterSelector:
+			if kind != ScalarNode {
+				children = node.Children()
+			}
+		}
+
+		for _, child := range children {
+			elem := e.childElement(child)
+			if err := eval.visit(elem); err != nil {
+				return nil, err
+			}
+
+			if filter, ok := selector.(parser.FilterSelector); ok {
+				if match, err := elem.matchesFilters(eval, []filters.Filter{filter.Filter}); err != nil {
+					return nil, err
+				} else if !match {
+					continue
+				}
+			}
+			selected = append(selected, elem)
+		}
+	}
+
+	return selected, nil
+}
+
+// RunJSONPathContext evaluates the segments of a JSONPath query (see parser.ParseJSONPath) and returns
+// its node list as defined by RFC 9535. Unlike results of other evaluations, nodes are in the order
+// of the selectors and of the nodes they are applied to, and nodes selected more than once are repeated.
+func RunJSONPathContext(ctx context.Context, parts []parser.QueryPart, rootElem Element, limits Limits) ([]Element, error) {
+	eval := newEvaluation(ctx, limits)
+	if err := eval.check(); err != nil {
+		return nil, err
+	}
+	return rootElem.nodeList(eval, parts, true)
+}
+
+// nodeList evaluates the segments on the element. If counted is true, the nodes are counted as results.
+func (e Element) nodeList(eval *evaluation, parts []parser.QueryPart, counted bool) ([]Element, error) {
+	nodes := []Element{e}
+	for i, part := range parts {
+		selected := []Element{}
+		for _, node := range nodes {
+			segmentNodes, err := node.segmentNodes(eval, part)
+			if err != nil {
+				return nil, err
+			}
+
+			// Nodes of the last segment are counted while they are found.
+			if counted && i == len(parts)-1 {
+				if err := eval.addResults(len(segmentNodes)); err != nil {
+					return nil, err
+				}
+			}
+			selected = append(selected, segmentNodes...)
+		}
+		nodes = selected
+	}
+
+	if counted && len(parts) == 0 {
+		return nodes, eval.addResults(len(nodes))
+	}
+	return nodes, nil
+}
+
+// segmentNodes returns the nodes selected by a segment of a JSONPath query on the element.
+// Descendant segments visit the element and its descendants, such that nodes are visited before their
+// descendants and children are visited in order.
+func (e Element) segmentNodes(eval *evaluation, part parser.QueryPart) ([]Element, error) {
+	if len(part.Selectors) > 0 {
+		return e.selectChildren(eval, part.Selectors)
+	}
+
+	nodes := []Element{}
+	add := func(elem Element) error {
+		if match, err := elem.matchesFilters(eval, part.Filters); err != nil || !match {
+			return err
+		}
+		nodes = append(nodes, elem)
+		return nil
+	}
+
+	var children []Node
+	switch {
+	case part.IsRecursive():
+		var visit func(elem Element) error
+		visit = func(elem Element) error {
+			if err := add(elem); err != nil {
+				return err
+			}
+			for _, child := range elem.node().Children() {
+				childElem := elem.childElement(child)
+				if err := eval.visit(childElem); err != nil {
+					return err
+				}
+				if err := visit(childElem); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return nodes, visit(e)
+
+	case part.IsWildcard():
+		children = e.node().Children()
+
+	default:
+		children = e.node().Lookup(part.Specifier)
+	}
+
+	for _, child := range children {
+		elem := e.childElement(child)
+		if err := eval.visit(elem); err != nil {
+			return nil, err
+		}
+		if err := add(elem); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// matchesFilters checks whether the element matches the filters. Filters with embedded queries
+// (JSONPath filter expressions) evaluate them relative to the element or the root of its document.
+func (e Element) matchesFilters(eval *evaluation, valueFilters []filters.Filter) (bool, error) {
+	for _, f := range valueFilters {
+		if contextFilter, ok := f.(parser.ContextFilter); ok {
+			if match, err := contextFilter.MatchContext(elementContext{elem: e, eval: eval}); err != nil || !match {
+				return false, err
+			}
+		} else if !f.IsMatch(e.Value) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// elementContext evaluates queries embedded in filters of the element.
+type elementContext struct {
+	elem Element
+	eval *evaluation
+}
+
+func (c elementContext) Query(query parser.EmbeddedQuery) ([]interface{}, error) {
+	start := c.elem
+	for query.Absolute && start.Parent != nil {
+		start = *start.Parent
+	}
+
+	// Embedded queries are JSONPath queries, whose node lists are passed to functions such as count().
+	nodes, err := start.nodeList(c.eval, query.Parts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	for _, node := range nodes {
+		values = append(values, Plain(node.Value))
+	}
+	return values, nil
+}
+
+// hasContextFilter checks whether any of the filters has embedded queries.
+func hasContextFilter(valueFilters []filters.Filter) bool {
+	for _, f := range valueFilters {
+		if _, ok := f.(parser.ContextFilter); ok {
+			return true
+		}
+	}
+	return false
+}
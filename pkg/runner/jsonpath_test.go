@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/natiiix/uniquery/pkg/parser"
+)
+
+// jsonPathTest is a test case of the conformance suite, which has the format of the JSONPath Compliance Test Suite.
+type jsonPathTest struct {
+	Name            string          `json:"name"`
+	Selector        string          `json:"selector"`
+	Document        json.RawMessage `json:"document"`
+	Result          []interface{}   `json:"result"`
+	ResultPaths     []string        `json:"result_paths"`
+	InvalidSelector bool            `json:"invalid_selector"`
+}
+
+// jsonPathNode is a node of a node list, which is identified by its normalized path.
+type jsonPathNode struct {
+	path  string
+	value interface{}
+}
+
+func TestJSONPathConformance(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/jsonpath-conformance.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suite := struct {
+		Tests []jsonPathTest `json:"tests"`
+	}{}
+	if err := json.Unmarshal(data, &suite); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(Options{Dialect: parser.JSONPathDialect})
+	for _, test := range suite.Tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			if test.InvalidSelector {
+				if _, err := parser.Parse(test.Selector, parser.JSONPathDialect); err == nil {
+					t.Errorf("Invalid selector `%s` was accepted", test.Selector)
+				}
+				return
+			}
+
+			document, err := r.DecodeJson(bytes.NewReader(test.Document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := r.RunNodes(test.Selector, document)
+			if err != nil {
+				t.Fatalf("Selector `%s` returned an error: %v", test.Selector, err)
+			}
+
+			actual := []jsonPathNode{}
+			for _, elem := range nodes {
+				actual = append(actual, jsonPathNode{elem.JSONPath(), Plain(elem.Value)})
+			}
+
+			expected := []jsonPathNode{}
+			for i, path := range test.ResultPaths {
+				expected = append(expected, jsonPathNode{path, test.Result[i]})
+			}
+
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Selector `%s` returned %v instead of %v", test.Selector, actual, expected)
+			}
+		})
+	}
+}
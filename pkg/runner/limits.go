@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Names of the limits reported by LimitError.
+const (
+	DepthLimit   = "depth"
+	NodesLimit   = "nodes"
+	ResultsLimit = "results"
+	TimeLimit    = "time"
+)
+
+// Limits restrict the resources used by a single evaluation of a query. Zero values mean no limit.
+type Limits struct {
+	// MaxDepth is the maximum depth of visited elements (children of the root have depth 1).
+	MaxDepth int
+	// MaxNodes is the maximum number of elements visited by the evaluation.
+	MaxNodes int
+	// MaxResults is the maximum number of results.
+	MaxResults int
+	// Timeout is the maximum duration of the evaluation.
+	Timeout time.Duration
+}
+
+// LimitError is returned when an evaluation exceeds one of its limits.
+type LimitError struct {
+	// Limit is the name of the exceeded limit (DepthLimit, NodesLimit, ResultsLimit or TimeLimit).
+	Limit string
+	// Max is the value of the exceeded limit.
+	Max interface{}
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("query evaluation exceeded the maximum %s (%v)", e.Limit, e.Max)
+}
+
+// checkInterval is the number of visited elements after which the context and the deadline are checked again.
+const checkInterval = 1024
+
+// evaluation tracks the resources used by a single evaluation of a query.
+type evaluation struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time
+	visited  int
+	results  int
+	// found holds the paths of results counted while they are found (see runPipeline), if they are.
+	found map[string]bool
+}
+
+func newEvaluation(ctx context.Context, limits Limits) *evaluation {
+	eval := &evaluation{ctx: ctx, limits: limits}
+	if limits.Timeout > 0 {
+		eval.deadline = time.Now().Add(limits.Timeout)
+	}
+	return eval
+}
+
+// unlimited is used by evaluations which cannot fail, such as Element.Query.
+func unlimited() *evaluation {
+	return newEvaluation(context.Background(), Limits{})
+}
+
+// check returns an error if the context has been cancelled or the deadline has passed.
+func (eval *evaluation) check() error {
+	if err := eval.ctx.Err(); err != nil {
+		return err
+	} else if !eval.deadline.IsZero() && time.Now().After(eval.deadline) {
+		return &LimitError{Limit: TimeLimit, Max: eval.limits.Timeout}
+	}
+	return nil
+}
+
+// visit counts the element as visited.
+func (eval *evaluation) visit(elem Element) error {
+	eval.visited++
+
+	if max := eval.limits.MaxNodes; max > 0 && eval.visited > max {
+		return &LimitError{Limit: NodesLimit, Max: max}
+	} else if max := eval.limits.MaxDepth; max > 0 && elem.depth() > max {
+		return &LimitError{Limit: DepthLimit, Max: max}
+	} else if eval.visited%checkInterval == 0 {
+		return eval.check()
+	}
+	return nil
+}
+
+// addResult counts the element as a result if results are counted while they are found.
+// Elements found more than once are counted once.
+func (eval *evaluation) addResult(elem Element) error {
+	if eval.found == nil {
+		return nil
+	}
+
+	path := elem.GetFullPath()
+	if eval.found[path] {
+		return nil
+	}
+	eval.found[path] = true
+	return eval.addResults(1)
+}
+
+// uncounted evaluates the function without counting the elements it finds as results,
+// which is used for queries embedded in filters.
+func (eval *evaluation) uncounted(fn func() error) error {
+	found := eval.found
+	eval.found = nil
+	defer func() { eval.found = found }()
+	return fn()
+}
+
+// addResults counts results emitted by a streaming evaluation or by an operator.
+func (eval *evaluation) addResults(count int) error {
+	eval.results += count
+	if max := eval.limits.MaxResults; max > 0 && eval.results > max {
+		return &LimitError{Limit: ResultsLimit, Max: max}
+	}
+	return nil
+}
+
+// depth returns the number of ancestors of the element.
+func (e Element) depth() int {
+	depth := 0
+	for elem := e.Parent; elem != nil; elem = elem.Parent {
+		depth++
+	}
+	return depth
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/natiiix/uniquery/pkg/parser"
+)
+
+var testTabLimits = []struct {
+	query  string
+	limits Limits
+	limit  string
+}{
+	{`**`, Limits{MaxDepth: 1}, DepthLimit},
+	{`*.*`, Limits{MaxNodes: 10}, NodesLimit},
+	{`*`, Limits{MaxResults: 2}, ResultsLimit},
+	{`**`, Limits{MaxResults: 2}, ResultsLimit},
+}
+
+func TestLimits(t *testing.T) {
+	for index, entry := range testTabLimits {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			r := NewRunner(Options{Limits: entry.limits})
+			run := func(name string, err error) {
+				limitErr := &LimitError{}
+				if !errors.As(err, &limitErr) || limitErr.Limit != entry.limit {
+					t.Errorf("Query `%s` (%s) with limits %+v returned %v instead of the %s limit error", entry.query, name, entry.limits, err, entry.limit)
+				}
+			}
+
+			_, err := r.RunJsonString(entry.query, complexJSON)
+			run("in memory", err)
+			run("stream", r.RunJsonStream(entry.query, strings.NewReader(complexJSON), func(Element) error { return nil }))
+		})
+	}
+
+	// Limits which are not exceeded do not change results.
+	r := NewRunner(Options{Limits: Limits{MaxDepth: 10, MaxNodes: 1000, MaxResults: 100, Timeout: time.Minute}})
+	if results, err := r.RunJsonString(`**`, complexJSON); err != nil {
+		t.Fatal(err)
+	} else if expected, _ := RunJsonString(`**`, complexJSON); len(results) != len(expected) {
+		t.Errorf("Limited query returned %d results instead of %d", len(results), len(expected))
+	}
+
+	// Results found more than once are counted once.
+	expected, _ := RunJsonString(`**.**`, complexJSON)
+	if results, err := NewRunner(Options{Limits: Limits{MaxResults: len(expected)}}).RunJsonString(`**.**`, complexJSON); err != nil || len(results) != len(expected) {
+		t.Errorf("Query with duplicate results returned %d results instead of %d (%v)", len(results), len(expected), err)
+	}
+
+	// Limits of JSON Lines apply to the whole stream.
+	err := NewRunner(Options{Limits: Limits{MaxResults: 2}}).RunNdjson(`msg`, strings.NewReader(logsNDJSON), func(Element) error { return nil })
+	if limitErr := (&LimitError{}); !errors.As(err, &limitErr) || limitErr.Limit != ResultsLimit {
+		t.Errorf("Unexpected JSON Lines error: %v", err)
+	}
+
+	// The deadline is checked periodically, so the document must be large enough.
+	large := make([]interface{}, 10*checkInterval)
+	for i := range large {
+		large[i] = map[string]interface{}{"id": i}
+	}
+	if _, err := NewRunner(Options{Limits: Limits{Timeout: time.Nanosecond}}).Run(`**`, large); err == nil {
+		t.Error("Query did not exceed the time limit")
+	} else if limitErr := (&LimitError{}); !errors.As(err, &limitErr) || limitErr.Limit != TimeLimit {
+		t.Errorf("Unexpected time limit error: %v", err)
+	}
+
+	// The evaluation stops as soon as there are too many results, without visiting the rest of the document.
+	stages, _ := parser.ParsePipeline(`**.id`)
+	eval := newEvaluation(context.Background(), Limits{MaxResults: 10})
+	if _, err := runPipeline(eval, stages, NewElementRoot(large)); err == nil {
+		t.Error("Query did not exceed the results limit")
+	} else if eval.visited > 100 {
+		t.Errorf("Evaluation visited %d elements after exceeding the results limit", eval.visited)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := defaultRunner.RunContext(ctx, `**`, map[string]interface{}{"a": 1}); err != context.Canceled {
+		t.Errorf("Cancelled query returned %v", err)
+	}
+}
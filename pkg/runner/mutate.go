@@ -0,0 +1,322 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/natiiix/uniquery/pkg/ordered"
+)
+
+// KeyPath returns the keys leading from the root element to the element.
+func (e Element) KeyPath() []interface{} {
+	path := []interface{}{}
+	for elem := &e; elem.Parent != nil; elem = elem.Parent {
+		path = append([]interface{}{elem.Key}, path...)
+	}
+	return path
+}
+
+// compareKeys orders keys of the same container. Array indices are compared numerically.
+func compareKeys(a interface{}, b interface{}) int {
+	aInt, aIsInt := a.(int)
+	bInt, bIsInt := b.(int)
+
+	if aIsInt && bIsInt {
+		return compareInts(aInt, bInt)
+	}
+
+	aStr, bStr := fmt.Sprintf("%#v", a), fmt.Sprintf("%#v", b)
+	if aStr < bStr {
+		return -1
+	} else if aStr > bStr {
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// compareKeyPaths orders key paths in document order, ancestors before their descendants.
+func compareKeyPaths(a []interface{}, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareKeys(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+func getChild(container interface{}, key interface{}) (interface{}, bool) {
+	switch t := container.(type) {
+	case map[string]interface{}:
+		if keyStr, ok := key.(string); ok {
+			child, exists := t[keyStr]
+			return child, exists
+		}
+
+	case *ordered.Map:
+		if keyStr, ok := key.(string); ok {
+			return t.Get(keyStr)
+		}
+
+	case map[interface{}]interface{}:
+		child, exists := t[key]
+		return child, exists
+
+	case []interface{}:
+		if index, ok := key.(int); ok && index >= 0 && index < len(t) {
+			return t[index], true
+		}
+	}
+
+	return nil, false
+}
+
+// setChild stores the value in the container. Containers are modified in place if possible.
+func setChild(container interface{}, key interface{}, value interface{}) (interface{}, error) {
+	switch t := container.(type) {
+	case map[string]interface{}:
+		if keyStr, ok := key.(string); ok {
+			t[keyStr] = value
+			return t, nil
+		}
+
+	case *ordered.Map:
+		if keyStr, ok := key.(string); ok {
+			t.Set(keyStr, value)
+			return t, nil
+		}
+
+	case map[interface{}]interface{}:
+		t[key] = value
+		return t, nil
+
+	case []interface{}:
+		if index, ok := key.(int); ok && index >= 0 && index < len(t) {
+			t[index] = value
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to set key %#v of %T", key, container)
+}
+
+// deleteChild removes the key from the container. Arrays are shortened, so a new array is returned.
+func deleteChild(container interface{}, key interface{}) (interface{}, error) {
+	switch t := container.(type) {
+	case map[string]interface{}:
+		if keyStr, ok := key.(string); ok {
+			delete(t, keyStr)
+			return t, nil
+		}
+
+	case *ordered.Map:
+		if keyStr, ok := key.(string); ok {
+			t.Delete(keyStr)
+			return t, nil
+		}
+
+	case map[interface{}]interface{}:
+		delete(t, key)
+		return t, nil
+
+	case []interface{}:
+		if index, ok := key.(int); ok && index >= 0 && index < len(t) {
+			shortened := make([]interface{}, 0, len(t)-1)
+			shortened = append(shortened, t[:index]...)
+			return append(shortened, t[index+1:]...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to delete key %#v of %T", key, container)
+}
+
+// mutatePath applies the modification to the container holding the last key of the path.
+// Every container along the path is stored back into its parent, because modifying arrays may replace them.
+func mutatePath(node interface{}, path []interface{}, modify func(container interface{}, key interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return modify(node, path[0])
+	}
+
+	child, exists := getChild(node, path[0])
+	if !exists {
+		return nil, fmt.Errorf("key %#v does not exist in %T", path[0], node)
+	}
+
+	newChild, err := mutatePath(child, path[1:], modify)
+	if err != nil {
+		return nil, err
+	}
+
+	return setChild(node, path[0], newChild)
+}
+
+// getPath finds the value at the key path.
+func getPath(node interface{}, path []interface{}) (interface{}, bool) {
+	for _, key := range path {
+		child, exists := getChild(node, key)
+		if !exists {
+			return nil, false
+		}
+		node = child
+	}
+
+	return node, true
+}
+
+// mutate evaluates the query and replaces the value of each result by the value returned by the update function
+// or, if remove is true, removes each result from its parent.
+// Results are processed in reverse document order, so that descendants are modified before their ancestors
+// and array items are deleted starting from the highest index.
+func (r *Runner) mutate(root interface{}, query string, update func(Element) (interface{}, error), remove bool) (interface{}, error) {
+	stages, err := r.parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	// Operators create new values and functions transform values without modifying the document,
+	// so neither of them selects anything that could be modified.
+	for _, stage := range stages {
+		if stage.Call != nil {
+			kind := "function"
+			if _, isOperator := operators[stage.Call.Name]; isOperator {
+				kind = "operator"
+			}
+			return nil, fmt.Errorf("%s %s cannot be used in a modifying query", kind, stage.Call.Name)
+		}
+	}
+
+	results, err := RunPipelineContext(context.Background(), stages, NewElementRoot(root), r.options.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documents are unwrapped and YAML documents are modified along with their node trees.
+	doc, isDoc := root.(*Document)
+	if isDoc {
+		root = doc.Root
+	}
+
+	elems := make([]Element, 0, len(results))
+	paths := make([][]interface{}, 0, len(results))
+	for _, e := range results {
+		path := e.KeyPath()
+		if isDoc && doc.Node != nil {
+			if err := checkYamlPath(doc.Node, path); err != nil {
+				return nil, err
+			}
+		}
+
+		elems = append(elems, e)
+		paths = append(paths, path)
+	}
+
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compareKeyPaths(paths[order[i]], paths[order[j]]) > 0
+	})
+
+	for _, i := range order {
+		elem, path := elems[i], paths[i]
+
+		var value interface{}
+		if !remove {
+			// The current value may differ from the result value, if its descendants have already been modified.
+			current, exists := getPath(root, path)
+			if !exists {
+				return nil, fmt.Errorf("element at %#v no longer exists", path)
+			}
+
+			elem.Value = current
+			if value, err = update(elem); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(path) == 0 {
+			root = value
+		} else {
+			root, err = mutatePath(root, path, func(container interface{}, key interface{}) (interface{}, error) {
+				if remove {
+					return deleteChild(container, key)
+				}
+				return setChild(container, key, value)
+			})
+		}
+
+		if err == nil && isDoc && doc.stream && len(path) == 0 {
+			// Replacing the whole stream leaves a single document.
+			doc.stream = false
+			doc.Node = &yaml.Node{Kind: yaml.DocumentNode}
+		}
+
+		if err == nil && isDoc && doc.Node != nil {
+			if remove {
+				err = deleteYamlNode(doc.Node, path)
+			} else {
+				err = setYamlNode(doc.Node, path, value)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if isDoc && doc.Node != nil {
+		// Modified anchored values are copied to their aliases.
+		if err := doc.decodeRoot(); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	} else if isDoc {
+		doc.Root = root
+		return doc, nil
+	}
+
+	return root, nil
+}
+
+// Update replaces the value of every element selected by the query with the value returned by the update function.
+// Containers are modified in place where possible. The returned root must be used from now on,
+// because it is a different value if the root itself has been selected.
+// Documents are modified in place and returned. Positions of their values are not updated.
+func (r *Runner) Update(root interface{}, query string, update func(Element) (interface{}, error)) (interface{}, error) {
+	return r.mutate(root, query, update, false)
+}
+
+// Set replaces the value of every element selected by the query.
+func (r *Runner) Set(root interface{}, query string, value interface{}) (interface{}, error) {
+	return r.Update(root, query, func(Element) (interface{}, error) {
+		return value, nil
+	})
+}
+
+// Delete removes every element selected by the query from its parent. Deleting the root element results in nil root.
+func (r *Runner) Delete(root interface{}, query string) (interface{}, error) {
+	return r.mutate(root, query, nil, true)
+}
+
+func Update(root interface{}, query string, update func(Element) (interface{}, error)) (interface{}, error) {
+	return defaultRunner.Update(root, query, update)
+}
+
+func Set(root interface{}, query string, value interface{}) (interface{}, error) {
+	return defaultRunner.Set(root, query, value)
+}
+
+func Delete(root interface{}, query string) (interface{}, error) {
+	return defaultRunner.Delete(root, query)
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RunNdjson runs the query on each record of a JSON Lines (NDJSON) stream. Records are decoded
+// and queried one at a time, so the memory usage does not depend on the length of the stream.
+// Results are passed to the emit function as soon as they are found, in document order.
+// Paths of the results begin with the line number of their record (starting at 1) and their positions
+// are positions in the whole stream. Empty lines are skipped. If the emit function returns an error,
+// the evaluation stops and the error is returned.
+func (r *Runner) RunNdjson(query string, reader io.Reader, emit func(Element) error) error {
+	return r.RunNdjsonContext(context.Background(), query, reader, emit)
+}
+
+// RunNdjsonContext runs the query like RunNdjson, but the evaluation stops with an error
+// when the context is cancelled or when a limit is exceeded (see LimitError). Limits apply to the whole stream.
+func (r *Runner) RunNdjsonContext(ctx context.Context, query string, reader io.Reader, emit func(Element) error) error {
+	stages, err := r.parseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	eval := newEvaluation(ctx, r.options.Limits)
+
+	lines := bufio.NewReader(reader)
+	offset := 0
+
+	for line := 1; ; line++ {
+		data, err := lines.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if record := bytes.TrimSpace(data); len(record) > 0 {
+			doc, err := decodeJsonSource(data, !r.options.PlainJSON)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			// Positions within the record are relative to its line.
+			doc.skippedLines = line - 1
+			doc.skippedBytes = offset
+
+			rootElem := NewElementRoot(doc)
+			rootElem.Key = line
+
+			results, err := runPipeline(eval, stages, rootElem)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+
+			for _, e := range Sorted(results) {
+				if err := emit(e); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		offset += len(data)
+	}
+}
+
+func (r *Runner) RunNdjsonFile(query string, ndjsonPath string, emit func(Element) error) error {
+	f, err := os.Open(ndjsonPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.RunNdjson(query, f, emit)
+}
+
+func RunNdjson(query string, r io.Reader, emit func(Element) error) error {
+	return defaultRunner.RunNdjson(query, r, emit)
+}
+
+func RunNdjsonFile(query string, ndjsonPath string, emit func(Element) error) error {
+	return defaultRunner.RunNdjsonFile(query, ndjsonPath, emit)
+}
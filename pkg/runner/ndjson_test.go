@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const logsNDJSON string = `{"level": "info", "msg": "started"}
+{"level": "error", "msg": "failed", "code": 500}
+
+{"level": "error", "msg": "retrying"}
+`
+
+// Paths of JSON Lines results begin with the line number of their record.
+var testTabNdjson = testTab{
+	{`level=error..msg`, logsNDJSON, map[string]interface{}{`2."msg"`: "failed", `4."msg"`: "retrying"}},
+	{`code`, logsNDJSON, map[string]interface{}{`2."code"`: 500.0}},
+	{``, logsNDJSON, map[string]interface{}{
+		`1`: map[string]interface{}{"level": "info", "msg": "started"},
+		`2`: map[string]interface{}{"level": "error", "msg": "failed", "code": 500.0},
+		`4`: map[string]interface{}{"level": "error", "msg": "retrying"},
+	}},
+	{`missing`, logsNDJSON, map[string]interface{}{}},
+}
+
+// Positions of JSON Lines results are positions in the whole stream.
+var testTabNdjsonPositions = []struct {
+	query     string
+	positions []string
+}{
+	{`level=error..msg`, []string{`2."msg" 2:20`, `4."msg" 4:20`}},
+	{`code`, []string{`2."code" 2:37`}},
+	{``, []string{`1 1:1`, `2 2:1`, `4 4:1`}},
+}
+
+func runNdjsonString(query string, source string) (map[string]Element, error) {
+	results := map[string]Element{}
+	err := RunNdjson(query, strings.NewReader(source), func(e Element) error {
+		results[e.GetFullPath()] = e
+		return nil
+	})
+	return results, err
+}
+
+func TestRunNdjson(t *testing.T) {
+	runTests(t, testTabNdjson, true, runNdjsonString)
+
+	for index, entry := range testTabNdjsonPositions {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			positions := []string{}
+			err := RunNdjson(entry.query, strings.NewReader(logsNDJSON), func(e Element) error {
+				position, _ := e.Position()
+				positions = append(positions, fmt.Sprintf("%s %v", e.GetFullPath(), position))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(positions, entry.positions) {
+				t.Errorf("Unexpected positions of query `%s` results: %v instead of %v", entry.query, positions, entry.positions)
+			}
+		})
+	}
+
+	if err := RunNdjson(`level`, strings.NewReader("{}\n{\n"), func(Element) error { return nil }); err == nil || err.Error() != "line 2: unexpected end of JSON input" {
+		t.Errorf("Unexpected error of invalid record: %v", err)
+	}
+}
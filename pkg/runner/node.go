@@ -0,0 +1,226 @@
+package runner
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/natiiix/uniquery/pkg/ordered"
+)
+
+// NodeKind is the kind of a node.
+type NodeKind int
+
+const (
+	// ScalarNode has no children. Its element has the value of the node.
+	ScalarNode NodeKind = iota
+	// MappingNode has children with string (or other) keys.
+	MappingNode
+	// SequenceNode has children with integer keys starting from 0.
+	SequenceNode
+)
+
+// Node is a source of data queried the same way as decoded documents. Elements whose values implement Node
+// are evaluated against the node instead of being traversed, so lazy sources (such as database rows
+// or remote APIs) can be queried without copying their data into maps first.
+//
+// Elements of scalar children have the values of the nodes, which may also be decoded containers
+// (such as map[string]interface{}), in which case they are queried as usual.
+// Elements of mapping and sequence children have the nodes as their values.
+type Node interface {
+	Kind() NodeKind
+	// Children returns the children of the node in document order.
+	Children() []Node
+	// Lookup returns the children selected by a query specifier, such as `name` or `2`. There is usually
+	// at most one, but keys of different types may match the same specifier (such as 1 and "1").
+	Lookup(spec string) []Node
+	// Value returns the value of a scalar node. Mapping and sequence nodes may return nil.
+	Value() interface{}
+	// Key returns the key of the node in its parent. The root node has nil key.
+	Key() interface{}
+	// Parent returns the parent of the node. The root node has nil parent.
+	Parent() Node
+}
+
+// IndexedNode is a Node which knows its index among the children of its parent (in document order),
+// so that results can be ordered without loading the other children (see Sorted).
+type IndexedNode interface {
+	Node
+	Index() int
+}
+
+// elementNode implements Node for decoded values (generic containers produced by decoders)
+// and values traversed using reflection.
+type elementNode struct {
+	elem Element
+}
+
+// node returns the node that the element is evaluated against.
+func (e Element) node() Node {
+	if n, ok := e.Value.(Node); ok {
+		return n
+	}
+	return elementNode{e}
+}
+
+// childElement creates the element of a child node.
+func (e *Element) childElement(child Node) Element {
+	if n, ok := child.(elementNode); ok {
+		return n.elem
+	}
+
+	var elem Element
+	if child.Kind() == ScalarNode {
+		elem = e.newChild(child.Value(), child.Key())
+	} else {
+		elem = e.newChild(child, child.Key())
+	}
+	elem.source = child
+	return elem
+}
+
+func (n elementNode) Kind() NodeKind {
+	switch n.elem.Value.(type) {
+	case map[string]interface{}, *ordered.Map, map[interface{}]interface{}:
+		return MappingNode
+
+	case []interface{}:
+		return SequenceNode
+
+	default:
+		return reflectKind(n.elem.Value)
+	}
+}
+
+func (n elementNode) child(value interface{}, key interface{}) Node {
+	return elementNode{n.elem.newChild(value, key)}
+}
+
+func (n elementNode) Children() []Node {
+	children := []Node{}
+
+	switch t := n.elem.Value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			children = append(children, n.child(t[k], k))
+		}
+
+	case *ordered.Map:
+		for _, k := range t.Keys() {
+			v, _ := t.Get(k)
+			children = append(children, n.child(v, k))
+		}
+
+	case map[interface{}]interface{}:
+		for _, k := range sortedKeys(t) {
+			children = append(children, n.child(t[k], k))
+		}
+
+	case []interface{}:
+		for k, v := range t {
+			children = append(children, n.child(v, k))
+		}
+
+	default:
+		children = n.reflectChildren()
+	}
+
+	return children
+}
+
+func (n elementNode) Lookup(spec string) []Node {
+	switch t := n.elem.Value.(type) {
+	case map[string]interface{}:
+		if child, exists := t[spec]; exists {
+			return []Node{n.child(child, spec)}
+		}
+
+	case *ordered.Map:
+		if child, exists := t.Get(spec); exists {
+			return []Node{n.child(child, spec)}
+		}
+
+	case map[interface{}]interface{}:
+		// All keys matching the specifier are selected, such as the string "on" and the boolean true of YAML 1.1.
+		children := []Node{}
+		for _, k := range sortedKeys(t) {
+			if compareKey(k, spec) {
+				children = append(children, n.child(t[k], k))
+			}
+		}
+		return children
+
+	case []interface{}:
+		if index, err := strconv.Atoi(spec); err == nil && (index >= 0 && index < len(t)) {
+			return []Node{n.child(t[index], index)}
+		}
+
+	default:
+		return n.reflectLookup(spec)
+	}
+
+	return nil
+}
+
+func (n elementNode) Value() interface{} {
+	return n.elem.Value
+}
+
+func (n elementNode) Key() interface{} {
+	return n.elem.Key
+}
+
+func (n elementNode) Parent() Node {
+	if n.elem.Parent == nil {
+		return nil
+	}
+	return n.elem.Parent.node()
+}
+
+// sortedKeys returns the keys of the map ordered by keyLess.
+func sortedKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+	return keys
+}
+
+// keyLess orders keys of maps without an order of their own. Numeric keys are ordered numerically
+// (so 2 is before 10) and before other keys, which are ordered by their representation in paths.
+func keyLess(a, b interface{}) bool {
+	x, aNumeric := keyNumber(a)
+	y, bNumeric := keyNumber(b)
+
+	if aNumeric != bNumeric {
+		return aNumeric
+	} else if aNumeric && x != y {
+		return x < y
+	}
+	return fmt.Sprintf("%#v", a) < fmt.Sprintf("%#v", b)
+}
+
+// keyNumber converts numeric keys to float64.
+func keyNumber(key interface{}) (float64, bool) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/natiiix/uniquery/pkg/ordered"
+)
+
+// keyOrders are the positions of the keys of unordered maps by the pointers of the maps,
+// so that the keys of every map are sorted only once while results are sorted.
+type keyOrders map[uintptr]map[interface{}]int
+
+// position returns the position of the key among the sorted keys of the map.
+func (o keyOrders) position(m interface{}, key interface{}) (int, bool) {
+	pointer := reflect.ValueOf(m).Pointer()
+	positions, ok := o[pointer]
+	if !ok {
+		positions = map[interface{}]int{}
+		for i, k := range unorderedKeys(m) {
+			positions[k] = i
+		}
+		o[pointer] = positions
+	}
+
+	if !isIndexableKey(key) {
+		return 0, false
+	}
+	position, ok := positions[key]
+	return position, ok
+}
+
+// unorderedKeys returns the keys of an unordered map in the order of their positions.
+func unorderedKeys(m interface{}) []interface{} {
+	switch t := m.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprintf("%#v", keys[i]) < fmt.Sprintf("%#v", keys[j])
+		})
+
+		result := make([]interface{}, len(keys))
+		for i, k := range keys {
+			result[i] = k
+		}
+		return result
+
+	case map[interface{}]interface{}:
+		return sortedKeys(t)
+
+	default:
+		keys := []interface{}{}
+		reflectEntries(m, func(key interface{}, _ reflect.Value) bool {
+			keys = append(keys, key)
+			return true
+		})
+		return keys
+	}
+}
+
+// position returns the index of the element among the children of its parent in document order.
+// Keys of unordered maps (without a YAML node) are ordered alphabetically.
+func (e Element) position(orders keyOrders) int {
+	if e.Parent == nil {
+		return 0
+	}
+
+	switch t := e.Parent.Value.(type) {
+	case []interface{}:
+		if index, ok := e.Key.(int); ok {
+			return index
+		}
+
+	case *ordered.Map:
+		if key, ok := e.Key.(string); ok {
+			return t.IndexOf(key)
+		}
+
+	case Node:
+		if indexed, ok := e.source.(IndexedNode); ok {
+			return indexed.Index()
+		}
+		for i, child := range t.Children() {
+			if child.Key() == e.Key {
+				return i
+			}
+		}
+
+	case map[string]interface{}, map[interface{}]interface{}:
+
+	default:
+		if v := indirect(reflect.ValueOf(t)); v.IsValid() && v.Kind() == reflect.Map {
+			if position, ok := orders.position(v.Interface(), e.Key); ok {
+				return position
+			}
+		} else if position, ok := reflectPosition(t, e.Key); ok {
+			return position
+		}
+	}
+
+	if node := resolveYamlNode(e.Parent.Node); node != nil && node.Kind == yaml.MappingNode {
+		if i := e.doc.yamlMappingIndex(node, e.Key); i >= 0 {
+			return i / 2
+		}
+	}
+
+	switch t := e.Parent.Value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		position, _ := orders.position(t, e.Key)
+		return position
+	}
+
+	return 0
+}
+
+// documentPosition returns the positions of the element and all its ancestors, starting from the root.
+func (e Element) documentPosition(orders keyOrders) []int {
+	positions := []int{}
+	for elem := &e; elem.Parent != nil; elem = elem.Parent {
+		positions = append([]int{elem.position(orders)}, positions...)
+	}
+	return positions
+}
+
+// Sorted returns the results in document order, ancestors before their descendants.
+func Sorted(results map[string]Element) []Element {
+	elems := make([]Element, 0, len(results))
+	positions := make([][]int, 0, len(results))
+	orders := keyOrders{}
+	for _, path := range sortedPaths(results) {
+		elems = append(elems, results[path])
+		positions = append(positions, results[path].documentPosition(orders))
+	}
+
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := positions[order[i]], positions[order[j]]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	sorted := make([]Element, len(elems))
+	for i, index := range order {
+		sorted[i] = elems[index]
+	}
+	return sorted
+}
@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PathFormat is a rendering of the path of an element.
+type PathFormat string
+
+const (
+	// CanonicalPath is a query selecting exactly the element, such as `jobs.build.steps.2.name`.
+	CanonicalPath PathFormat = "canonical"
+	// PointerPath is a JSON Pointer (RFC 6901), such as `/jobs/build/steps/2/name`.
+	PointerPath PathFormat = "pointer"
+	// JSONPathPath is a normalized JSONPath (RFC 9535), such as `$['jobs']['build']['steps'][2]['name']`.
+	JSONPathPath PathFormat = "jsonpath"
+)
+
+// PathFormats are all path formats.
+var PathFormats = []PathFormat{CanonicalPath, PointerPath, JSONPathPath}
+
+// FormatPath renders the path of the element in the format.
+func (e Element) FormatPath(format PathFormat) (string, error) {
+	switch format {
+	case CanonicalPath:
+		return e.Path(), nil
+	case PointerPath:
+		return e.JSONPointer(), nil
+	case JSONPathPath:
+		return e.JSONPath(), nil
+	default:
+		return "", fmt.Errorf("unknown path format: %s", format)
+	}
+}
+
+// pathElements returns the ancestors of the element (excluding the root) and the element itself,
+// beginning with the child of the root. The key of the root (the line number of a JSON Lines record)
+// is not a part of the path, because queries are evaluated on the root.
+func (e Element) pathElements() []Element {
+	elems := []Element{}
+	for elem := e; elem.Parent != nil; elem = *elem.Parent {
+		elems = append([]Element{elem}, elems...)
+	}
+	return elems
+}
+
+// keyString returns the key as it is matched by query specifiers.
+func keyString(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+// isIndex checks whether the key of the element is an index of a sequence.
+func (e Element) isIndex() bool {
+	if _, ok := e.Key.(int); !ok {
+		return false
+	}
+	// Parents of streamed elements have no value, but only sequences have integer keys in JSON.
+	return e.Parent.Value == nil || e.Parent.node().Kind() != MappingNode
+}
+
+// isBareRune checks whether the rune can be used in a specifier without quotes or escapes.
+func isBareRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-/:$+", r)
+}
+
+// quoteSpecifier renders the key as a specifier selecting exactly the child of the key.
+// Keys with special runes are quoted, or escaped if they contain a quote, which cannot be escaped inside quotes.
+func quoteSpecifier(key string) string {
+	bare := key != ""
+	for _, r := range key {
+		bare = bare && isBareRune(r)
+	}
+
+	if bare {
+		return key
+	} else if !strings.ContainsRune(key, '"') {
+		return `"` + key + `"`
+	}
+
+	sb := strings.Builder{}
+	for _, r := range key {
+		if !isBareRune(r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Path returns the canonical path of the element, which is a query selecting exactly the element
+// when it is evaluated on the root. Keys are quoted or escaped if they contain special runes
+// (e.g. `"a.b"` or `""`). The path of the root is empty.
+func (e Element) Path() string {
+	specifiers := []string{}
+	for _, elem := range e.pathElements() {
+		specifiers = append(specifiers, quoteSpecifier(keyString(elem.Key)))
+	}
+	return strings.Join(specifiers, ".")
+}
+
+// JSONPointer returns the path of the element as a JSON Pointer (RFC 6901). The pointer of the root is empty.
+func (e Element) JSONPointer() string {
+	sb := strings.Builder{}
+	for _, elem := range e.pathElements() {
+		sb.WriteRune('/')
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(keyString(elem.Key)))
+	}
+	return sb.String()
+}
+
+// JSONPath returns the path of the element as a normalized JSONPath (RFC 9535), which uses
+// bracket notation for all keys. Keys of mappings, which are not strings, are rendered as strings.
+func (e Element) JSONPath() string {
+	sb := strings.Builder{}
+	sb.WriteRune('$')
+	for _, elem := range e.pathElements() {
+		if elem.isIndex() {
+			sb.WriteString("[" + strconv.Itoa(elem.Key.(int)) + "]")
+			continue
+		}
+
+		sb.WriteString("['")
+		for _, r := range keyString(elem.Key) {
+			switch r {
+			case '\'', '\\':
+				sb.WriteRune('\\')
+				sb.WriteRune(r)
+			case '\b':
+				sb.WriteString(`\b`)
+			case '\f':
+				sb.WriteString(`\f`)
+			case '\n':
+				sb.WriteString(`\n`)
+			case '\r':
+				sb.WriteString(`\r`)
+			case '\t':
+				sb.WriteString(`\t`)
+			default:
+				if r < 0x20 {
+					fmt.Fprintf(&sb, `\u%04x`, r)
+				} else {
+					sb.WriteRune(r)
+				}
+			}
+		}
+		sb.WriteString("']")
+	}
+	return sb.String()
+}
@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const weirdKeysJSON string = `{
+	"a.b": {"": 1, "*": 2, "**": 3},
+	"say \"hi\"": [true, {"x|y": null}],
+	" sp": "upper()",
+	"upper()": {"0": "zero", "true": "yes", "1.5": "x"},
+	"new\nline": {"back\\slash": "@", "@": "=", "=": "~", "a/~b": "'"},
+	"name": {"first": "a"}
+}`
+
+const weirdKeysYAML string = `
+true:
+  push: on
+3: three
+1.5: [a, b]
+"it's": {"-": "+"}
+`
+
+var testTabPaths = []struct {
+	source    string
+	query     string
+	canonical string
+	pointer   string
+	jsonPath  string
+}{
+	{weirdKeysJSON, ``, ``, ``, `$`},
+	{weirdKeysJSON, `name.first`, `name.first`, `/name/first`, `$['name']['first']`},
+	{weirdKeysJSON, `"a.b".""`, `"a.b".""`, `/a.b/`, `$['a.b']['']`},
+	{weirdKeysJSON, `"a.b"."**"`, `"a.b"."**"`, `/a.b/**`, `$['a.b']['**']`},
+	{weirdKeysJSON, `" sp"`, `" sp"`, `/ sp`, `$[' sp']`},
+	{weirdKeysJSON, `say \"hi\".1."x|y"`, `say\ \"hi\".1."x|y"`, `/say "hi"/1/x|y`, `$['say "hi"'][1]['x|y']`},
+	{weirdKeysJSON, "\"new\nline\".\"back\\slash\"", "\"new\nline\".\"back\\slash\"", "/new\nline/back\\slash", `$['new\nline']['back\\slash']`},
+	{weirdKeysJSON, "\"new\nline\".\"a/~b\"", "\"new\nline\".\"a/~b\"", "/new\nline/a~1~0b", `$['new\nline']['a/~b']`},
+	{weirdKeysJSON, `upper().true`, `"upper()".true`, `/upper()/true`, `$['upper()']['true']`},
+	{weirdKeysYAML, `on.push`, `true.push`, `/true/push`, `$['true']['push']`},
+	{weirdKeysYAML, `3`, `3`, `/3`, `$['3']`},
+	{weirdKeysYAML, `"1.5".1`, `"1.5".1`, `/1.5/1`, `$['1.5'][1]`},
+	{weirdKeysYAML, `it's.-`, `"it's".-`, `/it's/-`, `$['it\'s']['-']`},
+}
+
+func TestPaths(t *testing.T) {
+	for _, doc := range []string{weirdKeysJSON, weirdKeysYAML} {
+		root, err := DecodeYaml(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		all, err := Run(`**`, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every canonical path is a query selecting exactly the element.
+		for fullPath, elem := range all {
+			results, err := Run(elem.Path(), root)
+			if err != nil {
+				t.Errorf("Path `%s` of `%s` is not a valid query: %v", elem.Path(), fullPath, err)
+			} else if _, ok := results[fullPath]; !ok || len(results) != 1 {
+				t.Errorf("Path `%s` of `%s` selected %v", elem.Path(), fullPath, results)
+			}
+		}
+	}
+
+	for index, entry := range testTabPaths {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			root, err := DecodeYaml(strings.NewReader(entry.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := Run(entry.query, root)
+			if err != nil || len(results) != 1 {
+				t.Fatalf("Query `%s` returned %v (%v)", entry.query, results, err)
+			}
+
+			for _, elem := range results {
+				for format, expected := range map[PathFormat]string{CanonicalPath: entry.canonical, PointerPath: entry.pointer, JSONPathPath: entry.jsonPath} {
+					if path, err := elem.FormatPath(format); err != nil || path != expected {
+						t.Errorf("Unexpected %s path of `%s`: %q instead of %q (%v)", format, entry.query, path, expected, err)
+					}
+				}
+			}
+		})
+	}
+
+	// The line number of a JSON Lines record is not a part of the paths of its elements.
+	err := RunNdjson(`msg`, strings.NewReader(logsNDJSON), func(elem Element) error {
+		if elem.Path() != "msg" || elem.JSONPointer() != "/msg" {
+			t.Errorf("Unexpected paths of a record element: %s, %s", elem.Path(), elem.JSONPointer())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Streamed elements have the same paths.
+	streamed := 0
+	err = RunJsonStream(`say\ \"hi\".1."x|y"`, strings.NewReader(weirdKeysJSON), func(elem Element) error {
+		streamed++
+		if elem.JSONPath() != `$['say "hi"'][1]['x|y']` {
+			t.Errorf("Unexpected JSONPath of a streamed element: %s", elem.JSONPath())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if streamed != 1 {
+		t.Errorf("Streamed query returned %d results instead of 1", streamed)
+	}
+}
@@ -0,0 +1,291 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/natiiix/uniquery/pkg/functions"
+	"github.com/natiiix/uniquery/pkg/ordered"
+	"github.com/natiiix/uniquery/pkg/parser"
+)
+
+// operator is evaluated on all results at once. Its arguments are parsed according to args.
+type operator struct {
+	args  parser.Operator
+	apply func(eval *evaluation, results map[string]Element, call *parser.Call) (map[string]Element, error)
+}
+
+var operators map[string]operator
+
+func init() {
+	operators = map[string]operator{
+		"group_by": {parser.Operator{MaxArgs: 1}, groupBy},
+		"count_by": {parser.Operator{MaxArgs: 1}, countBy},
+		"project":  {parser.Operator{MinArgs: 1, MaxArgs: maxProjectFields, Labeled: true}, project},
+	}
+
+	for name, op := range operators {
+		parser.RegisterOperator(name, op.args)
+	}
+}
+
+// maxProjectFields is the maximum number of fields of a projection.
+const maxProjectFields = 64
+
+// sortedPaths returns the paths of results in a deterministic order.
+func sortedPaths(results map[string]Element) []string {
+	paths := make([]string, 0, len(results))
+	for k := range results {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// bucketName converts a value to a string usable as a map key in operator output.
+func bucketName(value interface{}) string {
+	switch t := value.(type) {
+	case string:
+		return t
+
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+
+	case json.Number:
+		return string(t)
+
+	case nil:
+		return "null"
+
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+// subquery evaluates a pipeline given as an argument of an operator on the element.
+// Its results are not counted as results of the evaluation.
+func (e Element) subquery(eval *evaluation, stages []parser.Stage) (map[string]Element, error) {
+	var results map[string]Element
+	err := eval.uncounted(func() (err error) {
+		results, err = evalStages(eval, stages, e.ToMap(), -1)
+		return err
+	})
+	return results, err
+}
+
+// bucketize evaluates the key pipeline on every result and groups the results by the key values.
+// Results without any key value are left out. Without the key pipeline, results are grouped by their own values.
+func bucketize(eval *evaluation, results map[string]Element, call *parser.Call, add func(bucket string, elem Element)) error {
+	keyStages := []parser.Stage{}
+	if len(call.Pipelines) == 1 {
+		keyStages = call.Pipelines[0]
+	}
+
+	for _, elem := range Sorted(results) {
+		keys, err := elem.subquery(eval, keyStages)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range Sorted(keys) {
+			add(bucketName(key.Value), elem)
+		}
+	}
+
+	return nil
+}
+
+func groupBy(eval *evaluation, results map[string]Element, call *parser.Call) (map[string]Element, error) {
+	groups := map[string]interface{}{}
+
+	err := bucketize(eval, results, call, func(bucket string, elem Element) {
+		group, _ := groups[bucket].([]interface{})
+		groups[bucket] = append(group, elem.Value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewElementRoot(groups).ToMap(), nil
+}
+
+func countBy(eval *evaluation, results map[string]Element, call *parser.Call) (map[string]Element, error) {
+	counts := map[string]interface{}{}
+
+	err := bucketize(eval, results, call, func(bucket string, elem Element) {
+		count, _ := counts[bucket].(float64)
+		// Counts are float64, the type of numbers in plain values (see Plain and Options.PlainJSON).
+		counts[bucket] = count + 1
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewElementRoot(counts).ToMap(), nil
+}
+
+// project replaces the value of every result with an object whose fields are the values selected
+// by the labeled pipelines on the result. Fields whose pipelines select nothing are null,
+// fields whose pipelines select several values are arrays. The results keep their paths, same as with functions.
+func project(eval *evaluation, results map[string]Element, call *parser.Call) (map[string]Element, error) {
+	projected := map[string]Element{}
+	for k, e := range results {
+		object := ordered.NewMap()
+		for i, stages := range call.Pipelines {
+			fieldResults, err := e.subquery(eval, stages)
+			if err != nil {
+				return nil, err
+			}
+
+			var value interface{}
+			if sorted := Sorted(fieldResults); len(sorted) == 1 {
+				value = sorted[0].Value
+			} else if len(sorted) > 1 {
+				values := make([]interface{}, len(sorted))
+				for j, elem := range sorted {
+					values[j] = elem.Value
+				}
+				value = values
+			}
+			object.Set(call.Labels[i], value)
+		}
+
+		e.Value = object
+		projected[k] = e
+	}
+
+	return projected, nil
+}
+
+// applyOperator evaluates the operator on all results at once.
+func applyOperator(eval *evaluation, results map[string]Element, call *parser.Call, op operator) (map[string]Element, error) {
+	// Arguments of parsed pipelines are already parsed. Other calls are resolved on a copy,
+	// so that the caller's call is not modified.
+	if call.Pipelines == nil {
+		resolved := *call
+		if _, err := parser.ResolveOperator(&resolved); err != nil {
+			return nil, err
+		}
+		call = &resolved
+	}
+
+	return op.apply(eval, results, call)
+}
+
+// applyFunction replaces the value of every result with the value transformed by the function.
+// The results keep their paths, so they can still be navigated from.
+func applyFunction(results map[string]Element, call *parser.Call) (map[string]Element, bool, error) {
+	// Functions of parsed pipelines are already resolved.
+	fn := call.Function
+	if fn == nil {
+		args := make([]string, len(call.Args))
+		for i, arg := range call.Args {
+			args[i] = parser.Unquote(arg)
+		}
+
+		var exists bool
+		var err error
+		if fn, exists, err = functions.New(call.Name, args); !exists || err != nil {
+			return nil, exists, err
+		}
+	}
+
+	transformed := map[string]Element{}
+	for k, e := range results {
+		value, err := fn(e.Value)
+		if err != nil {
+			return nil, true, fmt.Errorf("%v (path `%s`)", err, k)
+		}
+		// Transformed elements keep the position of the original value.
+		e.Value = value
+		transformed[k] = e
+	}
+
+	return transformed, true, nil
+}
+
+// RunPipeline evaluates the pipeline stages one after another.
+// The first stage is evaluated on the root element, every other stage on the results of the previous one.
+func RunPipeline(stages []parser.Stage, rootElem Element) (map[string]Element, error) {
+	return RunPipelineContext(context.Background(), stages, rootElem, Limits{})
+}
+
+// RunPipelineContext evaluates the pipeline like RunPipeline, but the evaluation stops with an error
+// when the context is cancelled or when a limit is exceeded (see LimitError).
+func RunPipelineContext(ctx context.Context, stages []parser.Stage, rootElem Element, limits Limits) (map[string]Element, error) {
+	return runPipeline(newEvaluation(ctx, limits), stages, rootElem)
+}
+
+func runPipeline(eval *evaluation, stages []parser.Stage, rootElem Element) (map[string]Element, error) {
+	if err := eval.check(); err != nil {
+		return nil, err
+	}
+
+	// Results of the last query stage are counted while they are found, so that the evaluation stops
+	// as soon as there are too many of them. Functions keep the number of results, operators change it,
+	// so results of queries followed by operators are counted at the end.
+	counted := -1
+	for i, stage := range stages {
+		if stage.Call == nil {
+			counted = i
+		} else if _, isOperator := operators[stage.Call.Name]; isOperator {
+			counted = -1
+		}
+	}
+
+	results, err := evalStages(eval, stages, rootElem.ToMap(), counted)
+	if err != nil {
+		return nil, err
+	}
+
+	if counted < 0 {
+		if err := eval.addResults(len(results)); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// evalStages evaluates the stages on the results one after another.
+// Results of the stage with the counted index are counted while they are found.
+func evalStages(eval *evaluation, stages []parser.Stage, results map[string]Element, counted int) (map[string]Element, error) {
+	for i, stage := range stages {
+		if stage.Call != nil {
+			var err error
+			if op, exists := operators[stage.Call.Name]; exists {
+				results, err = applyOperator(eval, results, stage.Call, op)
+			} else if results, exists, err = applyFunction(results, stage.Call); !exists {
+				return nil, fmt.Errorf("unknown operator or function: %s", stage.Call.Name)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if i == counted {
+				eval.found = map[string]bool{}
+			}
+
+			stageResults := map[string]Element{}
+			for _, e := range results {
+				elemResults, err := e.query(eval, stage.Parts)
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range elemResults {
+					stageResults[k] = v
+				}
+			}
+			results = stageResults
+		}
+
+		if err := eval.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
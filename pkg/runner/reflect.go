@@ -0,0 +1,483 @@
+package runner
+
+import (
+	"encoding"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values other than the generic containers produced by decoders (structs, typed maps, typed slices, arrays
+// and pointers to them) are traversed using reflection, so Go values can be queried without being marshalled first.
+// Struct fields are named by their json tags (or yaml tags) like encoding/json names them.
+// Scalars of other types are converted to the types produced by decoders, so that filters and functions understand them.
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// reflectField is an exported struct field, including fields promoted from embedded structs.
+type reflectField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// reflectStruct holds the fields of a struct type, in declaration order and by their names.
+type reflectStruct struct {
+	fields []reflectField
+	byName map[string]reflectField
+}
+
+// reflectStructs caches fields of struct types, because their tags are parsed repeatedly.
+var reflectStructs sync.Map
+
+// indirect dereferences pointers and interfaces. The returned value is invalid if any of them is nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isReflectContainer returns true for values traversed using reflection.
+// Times and values with a text representation (such as net.IP) are scalars.
+func isReflectContainer(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		return v.Type() != timeType && !v.Type().Implements(textMarshalerType) && !reflect.PtrTo(v.Type()).Implements(textMarshalerType)
+
+	case reflect.Map, reflect.Array:
+		return !v.Type().Implements(textMarshalerType)
+
+	case reflect.Slice:
+		// Byte slices are encoded as strings by encoding/json.
+		return v.Type().Elem().Kind() != reflect.Uint8 && !v.Type().Implements(textMarshalerType)
+
+	default:
+		return false
+	}
+}
+
+// reflectValue returns the value of a child found using reflection. Containers are kept as they are
+// (including the pointers to them, which identify them in cycles), scalars are converted to the types produced by decoders.
+func reflectValue(v reflect.Value) interface{} {
+	container := v
+	for container.Kind() == reflect.Interface && !container.IsNil() {
+		container = container.Elem()
+	}
+
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	} else if isReflectContainer(v) {
+		return container.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return int(v.Int())
+
+	case reflect.Int64:
+		return v.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface()
+	}
+
+	marshaler, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok && v.CanAddr() {
+		marshaler, ok = v.Addr().Interface().(encoding.TextMarshaler)
+	}
+	if ok {
+		if text, err := marshaler.MarshalText(); err == nil {
+			return string(text)
+		}
+	} else if v.Kind() == reflect.String {
+		return v.String()
+	}
+
+	return v.Interface()
+}
+
+// fieldsOf returns the exported fields of the struct type.
+func fieldsOf(t reflect.Type) reflectStruct {
+	if cached, ok := reflectStructs.Load(t); ok {
+		return cached.(reflectStruct)
+	}
+
+	fields := reflectStruct{fields: structFields(t), byName: map[string]reflectField{}}
+	for _, f := range fields.fields {
+		fields.byName[f.name] = f
+	}
+
+	reflectStructs.Store(t, fields)
+	return fields
+}
+
+// structFields returns the exported fields of the struct type in declaration order.
+// Fields of embedded structs are promoted, unless the embedding struct has a field of the same name.
+func structFields(t reflect.Type) []reflectField {
+	candidates := []reflectField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "" {
+			tag = f.Tag.Get("yaml")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		name := tag
+		options := ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+
+		fieldType := f.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		// Untagged embedded structs and structs inlined by yaml tags have their fields promoted.
+		if (f.Anonymous && name == "" || strings.Contains(options, ",inline")) && fieldType.Kind() == reflect.Struct {
+			for _, promoted := range fieldsOf(fieldType).fields {
+				promoted.index = append([]int{i}, promoted.index...)
+				candidates = append(candidates, promoted)
+			}
+			continue
+		} else if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		candidates = append(candidates, reflectField{name: name, index: []int{i}, omitEmpty: strings.Contains(options, ",omitempty")})
+	}
+
+	// Fields of the shallowest depth win.
+	depths := map[string]int{}
+	for _, f := range candidates {
+		if depth, exists := depths[f.name]; !exists || len(f.index) < depth {
+			depths[f.name] = len(f.index)
+		}
+	}
+
+	fields := []reflectField{}
+	for _, f := range candidates {
+		if depths[f.name] == len(f.index) {
+			fields = append(fields, f)
+			// Following fields of the same name are ignored.
+			depths[f.name] = -1
+		}
+	}
+
+	return fields
+}
+
+// fieldByIndex returns the field of the struct. It is invalid if an embedded struct pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, fieldIndex := range index {
+		if i > 0 {
+			if v = indirect(v); !v.IsValid() {
+				return v
+			}
+		}
+		v = v.Field(fieldIndex)
+	}
+	return v
+}
+
+// structField returns the field of the struct, unless it is left out (see fieldByIndex and isEmptyValue).
+func structField(v reflect.Value, f reflectField) (reflect.Value, bool) {
+	field := fieldByIndex(v, f.index)
+	return field, field.IsValid() && !(f.omitEmpty && isEmptyValue(field))
+}
+
+// isEmptyValue matches values omitted by encoding/json because of omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+
+	case reflect.Bool:
+		return !v.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// reflectEntries calls the function for each child of the value (in document order) until it returns false.
+func reflectEntries(value interface{}, each func(key interface{}, child reflect.Value) bool) {
+	v := indirect(reflect.ValueOf(value))
+	if !v.IsValid() || !isReflectContainer(v) {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range fieldsOf(v.Type()).fields {
+			if field, ok := structField(v, f); ok && !each(f.name, field) {
+				return
+			}
+		}
+
+	case reflect.Map:
+		mapKeys := v.MapKeys()
+		keys := make([]interface{}, len(mapKeys))
+		order := make([]int, len(mapKeys))
+		for i, k := range mapKeys {
+			keys[i] = reflectValue(k)
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return keyLess(keys[order[i]], keys[order[j]])
+		})
+		for _, i := range order {
+			if !each(keys[i], v.MapIndex(mapKeys[i])) {
+				return
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !each(i, v.Index(i)) {
+				return
+			}
+		}
+	}
+}
+
+// reflectKind returns the kind of a value traversed using reflection.
+func reflectKind(value interface{}) NodeKind {
+	v := indirect(reflect.ValueOf(value))
+	if !v.IsValid() || !isReflectContainer(v) {
+		return ScalarNode
+	} else if v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+		return MappingNode
+	}
+	return SequenceNode
+}
+
+// reflectIdentity identifies containers which can be reached more than once (through pointers, maps or slices),
+// the same way encoding/json detects cycles.
+type reflectIdentity struct {
+	t       reflect.Type
+	pointer uintptr
+	length  int
+}
+
+// identityOf returns the identity of pointers, maps and slices.
+func identityOf(value interface{}) (reflectIdentity, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if !v.IsNil() {
+			return reflectIdentity{t: v.Type(), pointer: v.Pointer()}, true
+		}
+
+	case reflect.Slice:
+		if v.Len() > 0 {
+			return reflectIdentity{t: v.Type(), pointer: v.Pointer(), length: v.Len()}, true
+		}
+	}
+	return reflectIdentity{}, false
+}
+
+// ancestorIdentities returns the identities of the values of the element and its ancestors.
+func ancestorIdentities(elem *Element) map[reflectIdentity]bool {
+	identities := map[reflectIdentity]bool{}
+	for ; elem != nil; elem = elem.Parent {
+		if identity, ok := identityOf(elem.Value); ok {
+			identities[identity] = true
+		}
+	}
+	return identities
+}
+
+// isCycle reports whether the value of a child is the value of one of its ancestors.
+// Such children are left out, because their traversal would never end.
+func isCycle(ancestors map[reflectIdentity]bool, value interface{}) bool {
+	identity, ok := identityOf(value)
+	return ok && ancestors[identity]
+}
+
+// reflectChildren returns the children of a value traversed using reflection.
+func (n elementNode) reflectChildren() []Node {
+	ancestors := ancestorIdentities(&n.elem)
+	children := []Node{}
+	reflectEntries(n.elem.Value, func(key interface{}, child reflect.Value) bool {
+		if value := reflectValue(child); !isCycle(ancestors, value) {
+			children = append(children, n.child(value, key))
+		}
+		return true
+	})
+	return children
+}
+
+// reflectLookup returns the children whose keys match the specifier. Fields, items and entries of maps
+// with scalar keys are looked up directly, entries of other maps are searched.
+func (n elementNode) reflectLookup(spec string) []Node {
+	v := indirect(reflect.ValueOf(n.elem.Value))
+	if !v.IsValid() || !isReflectContainer(v) {
+		return nil
+	}
+
+	keys := []interface{}{}
+	values := []reflect.Value{}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if f, exists := fieldsOf(v.Type()).byName[spec]; exists {
+			if field, ok := structField(v, f); ok {
+				keys, values = append(keys, f.name), append(values, field)
+			}
+		}
+
+	case reflect.Map:
+		keys, values = reflectMapEntries(v, spec)
+
+	case reflect.Slice, reflect.Array:
+		if index, err := strconv.Atoi(spec); err == nil && index >= 0 && index < v.Len() && compareKey(index, spec) {
+			keys, values = append(keys, index), append(values, v.Index(index))
+		}
+	}
+
+	children := []Node{}
+	if len(values) == 0 {
+		return children
+	}
+
+	ancestors := ancestorIdentities(&n.elem)
+	for i, child := range values {
+		if value := reflectValue(child); !isCycle(ancestors, value) {
+			children = append(children, n.child(value, keys[i]))
+		}
+	}
+	return children
+}
+
+// reflectMapEntries returns the keys and the values of the map entries whose keys match the specifier.
+func reflectMapEntries(v reflect.Value, spec string) ([]interface{}, []reflect.Value) {
+	keys := []interface{}{}
+	values := []reflect.Value{}
+
+	if !isScalarKey(v.Type().Key()) {
+		// Keys of other types are searched.
+		reflectEntries(v.Interface(), func(key interface{}, value reflect.Value) bool {
+			if compareKey(key, spec) {
+				keys, values = append(keys, key), append(values, value)
+			}
+			return true
+		})
+		return keys, values
+	}
+
+	for _, k := range reflectMapKeys(v.Type().Key(), spec) {
+		if key := reflectValue(k); compareKey(key, spec) {
+			if value := v.MapIndex(k); value.IsValid() {
+				keys, values = append(keys, key), append(values, value)
+			}
+		}
+	}
+	return keys, values
+}
+
+// isScalarKey returns true for types of map keys which reflectMapKeys creates from specifiers.
+func isScalarKey(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// reflectMapKeys returns the map keys of the type which may match the specifier.
+func reflectMapKeys(t reflect.Type, spec string) []reflect.Value {
+	if !isScalarKey(t) {
+		return nil
+	}
+
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(spec)
+
+	case reflect.Bool:
+		k.SetBool(true)
+		return []reflect.Value{k, reflect.Zero(t)}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(spec, 10, 64)
+		if err != nil || k.OverflowInt(i) {
+			return nil
+		}
+		k.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(spec, 10, 64)
+		if err != nil || k.OverflowUint(u) {
+			return nil
+		}
+		k.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(spec, 64)
+		if err != nil || k.OverflowFloat(f) {
+			return nil
+		}
+		k.SetFloat(f)
+	}
+	return []reflect.Value{k}
+}
+
+// reflectPosition returns the index of the child among the children of a value traversed using reflection.
+func reflectPosition(value interface{}, key interface{}) (int, bool) {
+	position, found := 0, false
+	reflectEntries(value, func(childKey interface{}, _ reflect.Value) bool {
+		if found = childKey == key; !found {
+			position++
+		}
+		return !found
+	})
+	return position, found
+}
@@ -1,81 +1,171 @@
 package runner
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"log"
 	"os"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/natiiix/uniquery/pkg/parser"
 )
 
-var Verbose bool = false
+// Options configure the behaviour of a Runner.
+type Options struct {
+	// Verbose enables logging of additional information, mostly for debugging purposes.
+	Verbose bool
+	// Logger receives the verbose output. The standard logger is used if it is nil.
+	Logger *log.Logger
+	// Limits restrict the resources used by each evaluation of a query.
+	Limits Limits
+	// Indent is the number of spaces used to indent encoded documents. If it is zero, JSON is indented
+	// by 4 spaces and YAML keeps the indentation of the decoded document (or uses 2 spaces).
+	Indent int
+	// Dialect is the language of queries. UniQuery queries are expected if it is empty.
+	Dialect parser.Dialect
+	// PlainJSON decodes JSON into the same types as encoding/json (map[string]interface{} and float64).
+	// Otherwise, JSON objects are decoded as *ordered.Map, which keeps the order of their keys, and numbers
+	// as json.Number, which keeps their literals, so that results are in document order and numbers
+	// are compared and encoded exactly.
+	PlainJSON bool
+	// YAMLStreams decodes every YAML document as a stream, which is an array with an item for each document,
+	// even if there is only one, so that queries of bundles (such as `*.kind=Deployment`) do not depend on
+	// the number of documents. Otherwise, only streams of multiple documents are arrays.
+	YAMLStreams bool
+}
+
+// Runner evaluates queries with its own options, so that callers within the same process can be configured
+// independently. It is safe for concurrent use. The package-level functions use a runner with default options.
+type Runner struct {
+	options Options
+}
+
+func NewRunner(options Options) *Runner {
+	return &Runner{options: options}
+}
+
+var defaultRunner = NewRunner(Options{})
 
-func Run(query string, root interface{}) map[string]Element {
-	queryParts := parser.ParseQuery(query)
-	if Verbose {
-		log.Printf("Parsed query: %+q\n", queryParts)
+// logf logs the message in verbose mode.
+func (r *Runner) logf(format string, args ...interface{}) {
+	if !r.options.Verbose {
+		return
+	} else if r.options.Logger != nil {
+		r.options.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
 	}
-	rootElem := NewElementRoot(root)
-	results := rootElem.Query(queryParts)
-	return results
 }
 
-func RunJson(query string, jsonData []byte) (map[string]Element, error) {
-	var root interface{}
-	err := json.Unmarshal(jsonData, &root)
+// parseQuery parses the query and, in verbose mode, logs the parsed stages.
+func (r *Runner) parseQuery(query string) ([]parser.Stage, error) {
+	stages, err := parser.Parse(query, r.options.Dialect)
 	if err != nil {
 		return nil, err
 	}
 
-	return Run(query, root), nil
+	r.logf("Parsed query: %+v\n", stages)
+	return stages, nil
 }
 
-func RunJsonString(query string, jsonStr string) (map[string]Element, error) {
-	return RunJson(query, []byte(jsonStr))
+func (r *Runner) Run(query string, root interface{}) (map[string]Element, error) {
+	return r.RunContext(context.Background(), query, root)
 }
 
-func RunJsonFile(query string, jsonPath string) (map[string]Element, error) {
-	f, err := os.Open(jsonPath)
+// RunContext evaluates the query like Run, but the evaluation stops with an error
+// when the context is cancelled or when a limit is exceeded (see LimitError).
+func (r *Runner) RunContext(ctx context.Context, query string, root interface{}) (map[string]Element, error) {
+	stages, err := r.parseQuery(query)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return RunPipelineContext(ctx, stages, NewElementRoot(root), r.options.Limits)
+}
+
+// RunNodes evaluates the query and returns its results as a list. Results of JSONPath queries are node lists
+// as defined by RFC 9535, which are in the order of the selectors and repeat nodes selected more than once.
+// Results of other queries are unique and in document order (see Sorted).
+func (r *Runner) RunNodes(query string, root interface{}) ([]Element, error) {
+	return r.RunNodesContext(context.Background(), query, root)
+}
 
-	var root interface{}
-	if err = json.NewDecoder(f).Decode(&root); err != nil {
+// RunNodesContext evaluates the query like RunNodes, but the evaluation stops with an error
+// when the context is cancelled or when a limit is exceeded (see LimitError).
+func (r *Runner) RunNodesContext(ctx context.Context, query string, root interface{}) ([]Element, error) {
+	stages, err := r.parseQuery(query)
+	if err != nil {
 		return nil, err
 	}
 
-	return Run(query, root), nil
-}
+	if r.options.Dialect == parser.JSONPathDialect {
+		return RunJSONPathContext(ctx, stages[0].Parts, NewElementRoot(root), r.options.Limits)
+	}
 
-func RunYaml(query string, yamlData []byte) (map[string]Element, error) {
-	var root interface{}
-	err := yaml.Unmarshal(yamlData, &root)
+	results, err := RunPipelineContext(ctx, stages, NewElementRoot(root), r.options.Limits)
 	if err != nil {
 		return nil, err
 	}
+	return Sorted(results), nil
+}
 
-	return Run(query, root), nil
+func (r *Runner) RunJson(query string, jsonData []byte) (map[string]Element, error) {
+	return r.RunFormat(query, JsonFormat, bytes.NewReader(jsonData))
 }
 
-func RunYamlString(query string, yamlStr string) (map[string]Element, error) {
-	return RunYaml(query, []byte(yamlStr))
+func (r *Runner) RunJsonString(query string, jsonStr string) (map[string]Element, error) {
+	return r.RunJson(query, []byte(jsonStr))
+}
+
+func (r *Runner) RunJsonFile(query string, jsonPath string) (map[string]Element, error) {
+	return r.runFormatFile(query, JsonFormat, jsonPath)
 }
 
-func RunYamlFile(query string, jsonPath string) (map[string]Element, error) {
-	f, err := os.Open(jsonPath)
+func (r *Runner) RunYaml(query string, yamlData []byte) (map[string]Element, error) {
+	return r.RunFormat(query, YamlFormat, bytes.NewReader(yamlData))
+}
+
+func (r *Runner) RunYamlString(query string, yamlStr string) (map[string]Element, error) {
+	return r.RunYaml(query, []byte(yamlStr))
+}
+
+func (r *Runner) RunYamlFile(query string, yamlPath string) (map[string]Element, error) {
+	return r.runFormatFile(query, YamlFormat, yamlPath)
+}
+
+// runFormatFile decodes the file in the format and evaluates the query on it.
+func (r *Runner) runFormatFile(query string, f Format, path string) (map[string]Element, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	defer file.Close()
 
-	var root interface{}
-	if err = yaml.NewDecoder(f).Decode(&root); err != nil {
-		return nil, err
-	}
+	return r.RunFormat(query, f, file)
+}
+
+func Run(query string, root interface{}) (map[string]Element, error) {
+	return defaultRunner.Run(query, root)
+}
+
+func RunJson(query string, jsonData []byte) (map[string]Element, error) {
+	return defaultRunner.RunJson(query, jsonData)
+}
+
+func RunJsonString(query string, jsonStr string) (map[string]Element, error) {
+	return defaultRunner.RunJsonString(query, jsonStr)
+}
+
+func RunJsonFile(query string, jsonPath string) (map[string]Element, error) {
+	return defaultRunner.RunJsonFile(query, jsonPath)
+}
+
+func RunYaml(query string, yamlData []byte) (map[string]Element, error) {
+	return defaultRunner.RunYaml(query, yamlData)
+}
+
+func RunYamlString(query string, yamlStr string) (map[string]Element, error) {
+	return defaultRunner.RunYamlString(query, yamlStr)
+}
 
-	return Run(query, root), nil
+func RunYamlFile(query string, yamlPath string) (map[string]Element, error) {
+	return defaultRunner.RunYamlFile(query, yamlPath)
 }
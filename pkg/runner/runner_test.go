@@ -1,11 +1,26 @@
 package runner
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+	"github.com/natiiix/uniquery/pkg/functions"
+	"github.com/natiiix/uniquery/pkg/parser"
 )
 
 type testTab []struct {
@@ -209,6 +224,8 @@ var testTabJSONEqualityInverted = testTab{
 var testTabJSONRegex = testTab{
 	{`*.name~" Doe$"`, complexJSON, map[string]interface{}{`0."name"`: "John Doe", `1."name"`: "Jane Doe"}},
 	{`*.name~"^John "`, complexJSON, map[string]interface{}{`0."name"`: "John Doe", `2."name"`: "John Daniel"}},
+	{`*.name~^John|Jane`, complexJSON, map[string]interface{}{`0."name"`: "John Doe", `1."name"`: "Jane Doe", `2."name"`: "John Daniel"}},
+	{`*.name~Doe$|Denver$ | upper()`, complexJSON, map[string]interface{}{`0."name"`: "JOHN DOE", `1."name"`: "JANE DOE", `3."name"`: "ROBERT DENVER", `4."name"`: "CLARK DENVER"}},
 }
 
 var testTabJSONRegexInverted = testTab{
@@ -216,6 +233,173 @@ var testTabJSONRegexInverted = testTab{
 	{`*.name!~"^John "`, complexJSON, map[string]interface{}{`1."name"`: "Jane Doe", `3."name"`: "Robert Denver", `4."name"`: "Clark Denver"}},
 }
 
+var testTabJSONGroupBy = testTab{
+	{`* | count_by(debt)`, complexJSON, map[string]interface{}{``: map[string]interface{}{"0": 2.0, "1000": 1.0, "2000": 1.0, "10000": 1.0}}},
+	{`*.debt | count_by()`, complexJSON, map[string]interface{}{``: map[string]interface{}{"0": 2.0, "1000": 1.0, "2000": 1.0, "10000": 1.0}}},
+	{`* | count_by(debt) | 0`, complexJSON, map[string]interface{}{`"0"`: 2.0}},
+	{`* | count_by(missing)`, complexJSON, map[string]interface{}{``: map[string]interface{}{}}},
+	{`*.name~Denver. | group_by(debt)`, complexJSON, map[string]interface{}{``: map[string]interface{}{
+		"0":     []interface{}{map[string]interface{}{"name": "Robert Denver", "debt": 0.0}},
+		"10000": []interface{}{map[string]interface{}{"name": "Clark Denver", "debt": 10000.0}},
+	}}},
+	{`*.debt=0. | group_by(debt) | *.*.name`, complexJSON, map[string]interface{}{`"0".0."name"`: "John Daniel", `"0".1."name"`: "Robert Denver"}},
+}
+
+// Projections are compared as JSON, which keeps the order of their fields.
+var testTabJSONProject = []struct {
+	query    string
+	expected map[string]string
+}{
+	{`0 | project(name)`, map[string]string{`0`: `{"name":"John Doe"}`}},
+	{`*.name~Denver$. | project(debt, name: name | upper(), first: name | split(" ") | 0)`, map[string]string{
+		`3`: `{"debt":0,"name":"ROBERT DENVER","first":"Robert"}`,
+		`4`: `{"debt":10000,"name":"CLARK DENVER","first":"Clark"}`,
+	}},
+	{`0 | project("full name": name, missing, all: *)`, map[string]string{`0`: `{"full name":"John Doe","missing":null,"all":["John Doe",1000]}`}},
+	{`0 | project(name~^John | lower())`, map[string]string{`0`: `{"name~^John | lower()":"john doe"}`}},
+	{`* | project(name: name | lower()) | count_by(name | split(" ") | 1)`, map[string]string{``: `{"daniel":1,"denver":2,"doe":2}`}},
+	{`* | count_by(name | regex_capture("^(\w+)"))`, map[string]string{``: `{"Clark":1,"Jane":1,"John":2,"Robert":1}`}},
+}
+
+func TestRunJSONProject(t *testing.T) {
+	for index, entry := range testTabJSONProject {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			results, err := RunJsonString(entry.query, complexJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := map[string]string{}
+			for path, elem := range results {
+				data, err := json.Marshal(elem.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual[path] = string(data)
+			}
+
+			if !cmp.Equal(actual, entry.expected) {
+				t.Errorf("Unexpected projection: %v instead of %v", actual, entry.expected)
+			}
+		})
+	}
+}
+
+var testTabJSONFunctions = testTab{
+	{`0.name | upper()`, complexJSON, map[string]interface{}{`0."name"`: "JOHN DOE"}},
+	{`0.name | lower()`, complexJSON, map[string]interface{}{`0."name"`: "john doe"}},
+	{`0.name | split(" ")`, complexJSON, map[string]interface{}{`0."name"`: []interface{}{"John", "Doe"}}},
+	{`0.name | split(" ") | join(_)`, complexJSON, map[string]interface{}{`0."name"`: "John_Doe"}},
+	{`0.name | split(" ") | 1`, complexJSON, map[string]interface{}{`0."name".1`: "Doe"}},
+	{`0.name | replace(Doe, Smith)`, complexJSON, map[string]interface{}{`0."name"`: "John Smith"}},
+	{`0.name | replace(" ", \,)`, complexJSON, map[string]interface{}{`0."name"`: "John,Doe"}},
+	{`0.name | replace(" ", "(, )")`, complexJSON, map[string]interface{}{`0."name"`: "John(, )Doe"}},
+	{`0.name | substr(5)`, complexJSON, map[string]interface{}{`0."name"`: "Doe"}},
+	{`0.name | substr(0, 4)`, complexJSON, map[string]interface{}{`0."name"`: "John"}},
+	{`0.name | substr(2, 100)`, complexJSON, map[string]interface{}{`0."name"`: "hn Doe"}},
+	{`0.name | regex_capture("^(\w+)")`, complexJSON, map[string]interface{}{`0."name"`: "John"}},
+	{`0.name | regex_capture("^(\w+) (\w+)$")`, complexJSON, map[string]interface{}{`0."name"`: []interface{}{"John", "Doe"}}},
+	{`0.name | regex_capture(xyz)`, complexJSON, map[string]interface{}{`0."name"`: nil}},
+	{`*.name~Denver | upper() | trim()`, complexJSON, map[string]interface{}{`3."name"`: "ROBERT DENVER", `4."name"`: "CLARK DENVER"}},
+}
+
+var testTabJSONFunctionErrors = testTab{
+	{`0.debt | upper()`, complexJSON, nil},
+	{`0 | trim()`, complexJSON, nil},
+	{`0.name | join(",")`, complexJSON, nil},
+	{`0.name | substr(a)`, complexJSON, nil},
+	{`0.name | replace(a)`, complexJSON, nil},
+	{`0.name | nonexistent()`, complexJSON, nil},
+	{`0 | project()`, complexJSON, nil},
+	{`0 | project(name | nonexistent())`, complexJSON, nil},
+	{`0 | project(debt | upper())`, complexJSON, nil},
+	{`* | count_by(debt | lower())`, complexJSON, nil},
+}
+
+const dateTimeJSON string = `{
+	"a": "2019-12-31T23:59:59Z",
+	"b": "2020-01-01",
+	"c": "2020-01-01 12:00:00 +0100",
+	"d": "15/Mar/2020:08:30:00 +0000",
+	"e": "not a date",
+	"f": 2020
+}`
+
+var testTabJSONDateTime = testTab{
+	{`*@<2020-01-01`, dateTimeJSON, map[string]interface{}{`"a"`: "2019-12-31T23:59:59Z"}},
+	{`*@<=2020-01-01`, dateTimeJSON, map[string]interface{}{`"a"`: "2019-12-31T23:59:59Z", `"b"`: "2020-01-01"}},
+	{`*@=2020-01-01`, dateTimeJSON, map[string]interface{}{`"b"`: "2020-01-01"}},
+	{`*@>2020-01-01`, dateTimeJSON, map[string]interface{}{`"c"`: "2020-01-01 12:00:00 +0100", `"d"`: "15/Mar/2020:08:30:00 +0000"}},
+	{`*@>2020-01-01+12h`, dateTimeJSON, map[string]interface{}{`"d"`: "15/Mar/2020:08:30:00 +0000"}},
+	{`*@>=2020-01-01T11:00:00Z`, dateTimeJSON, map[string]interface{}{`"c"`: "2020-01-01 12:00:00 +0100", `"d"`: "15/Mar/2020:08:30:00 +0000"}},
+	{`*@>2020-03-22-1w`, dateTimeJSON, map[string]interface{}{`"d"`: "15/Mar/2020:08:30:00 +0000"}},
+	{`*@<now`, dateTimeJSON, map[string]interface{}{`"a"`: "2019-12-31T23:59:59Z", `"b"`: "2020-01-01", `"c"`: "2020-01-01 12:00:00 +0100", `"d"`: "15/Mar/2020:08:30:00 +0000"}},
+	{`*@>now-7d`, dateTimeJSON, map[string]interface{}{}},
+	{`*!@<2020-01-01`, dateTimeJSON, map[string]interface{}{`"b"`: "2020-01-01", `"c"`: "2020-01-01 12:00:00 +0100", `"d"`: "15/Mar/2020:08:30:00 +0000", `"e"`: "not a date", `"f"`: 2020.0}},
+	// Examples of YAML timestamps (https://yaml.org/type/timestamp.html), including time zones with single-digit hours.
+	{`*@="2001-12-15T02:59:43.1Z"`, yamlTimestampsJSON, map[string]interface{}{
+		`"canonical"`: "2001-12-15T2:59:43.10Z",
+		`"iso8601"`:   "2001-12-14t21:59:43.10-05:00",
+		`"spaced"`:    "2001-12-14 21:59:43.10 -5",
+		`"spacedMin"`: "2001-12-15 8:29:43.10 +5:30",
+	}},
+	{`*@="2001-12-14 21:59:43.10 -5"`, yamlTimestampsJSON, map[string]interface{}{
+		`"canonical"`: "2001-12-15T2:59:43.10Z",
+		`"iso8601"`:   "2001-12-14t21:59:43.10-05:00",
+		`"spaced"`:    "2001-12-14 21:59:43.10 -5",
+		`"spacedMin"`: "2001-12-15 8:29:43.10 +5:30",
+	}},
+	{`*@=2002-12-14`, yamlTimestampsJSON, map[string]interface{}{`"date"`: "2002-12-14"}},
+}
+
+const yamlTimestampsJSON string = `{
+	"canonical": "2001-12-15T2:59:43.10Z",
+	"iso8601": "2001-12-14t21:59:43.10-05:00",
+	"spaced": "2001-12-14 21:59:43.10 -5",
+	"spacedMin": "2001-12-15 8:29:43.10 +5:30",
+	"date": "2002-12-14"
+}`
+
+const packageJSON string = `{
+	"name": "example",
+	"version": "1.10.0",
+	"dependencies": {
+		"left-pad": "^1.3.0",
+		"lodash": "4.17.21",
+		"react": "~16.9.0"
+	}
+}`
+
+var testTabJSONSemver = testTab{
+	{`version@semver(>1.9)`, packageJSON, map[string]interface{}{`"version"`: "1.10.0"}},
+	{`version@semver(">=1.2.0 <2.0.0")`, packageJSON, map[string]interface{}{`"version"`: "1.10.0"}},
+	{`dependencies.*@semver(<5)`, packageJSON, map[string]interface{}{`"dependencies"."left-pad"`: "^1.3.0", `"dependencies"."lodash"`: "4.17.21"}},
+	{`dependencies.*!@semver(<5)`, packageJSON, map[string]interface{}{`"dependencies"."react"`: "~16.9.0"}},
+	{`**@semver("^16 || ^1.3")`, packageJSON, map[string]interface{}{`"version"`: "1.10.0", `"dependencies"."left-pad"`: "^1.3.0", `"dependencies"."react"`: "~16.9.0"}},
+}
+
+const firewallJSON string = `{
+	"rules": [
+		{"name": "internal", "source": "10.1.2.3"},
+		{"name": "office", "source": "192.168.0.0/24"},
+		{"name": "vpn", "source": "10.0.0.0/7"},
+		{"name": "public", "source": "203.0.113.7"},
+		{"name": "ipv6", "source": "2001:db8::1"},
+		{"name": "mapped", "source": "::ffff:10.0.0.1"},
+		{"name": "invalid", "source": "10.0.0.256"}
+	]
+}`
+
+var testTabJSONIP = testTab{
+	{`rules.*.source@cidr_in(10.0.0.0/8)..name`, firewallJSON, map[string]interface{}{`"rules".0."name"`: "internal", `"rules".5."name"`: "mapped"}},
+	{`rules.*.source@cidr_in(10.0.0.0/8, 192.168.0.0/16)..name`, firewallJSON, map[string]interface{}{`"rules".0."name"`: "internal", `"rules".1."name"`: "office", `"rules".5."name"`: "mapped"}},
+	{`rules.*.source@ip!@cidr_in(10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16)..name`, firewallJSON, map[string]interface{}{`"rules".2."name"`: "vpn", `"rules".3."name"`: "public", `"rules".4."name"`: "ipv6"}},
+	{`rules.*.source@cidr_in(2001:db8::/32)..name`, firewallJSON, map[string]interface{}{`"rules".4."name"`: "ipv6"}},
+	{`rules.*.source@ipv4..name`, firewallJSON, map[string]interface{}{`"rules".0."name"`: "internal", `"rules".1."name"`: "office", `"rules".2."name"`: "vpn", `"rules".3."name"`: "public"}},
+	{`rules.*.source@ipv6..name`, firewallJSON, map[string]interface{}{`"rules".4."name"`: "ipv6", `"rules".5."name"`: "mapped"}},
+	{`rules.*.source!@ip..name`, firewallJSON, map[string]interface{}{`"rules".6."name"`: "invalid"}},
+}
+
 const complexYAML = `name: Go
 on: [push, pull_request]
 jobs:
@@ -264,6 +448,114 @@ var testTabYAMLGeneral = testTab{
 
 	// NOTE: This checks that duplicate results are filtered out.
 	{`on.*~^pu.`, complexYAML, map[string]interface{}{`true`: []interface{}{"push", "pull_request"}}},
+
+	// All keys matching the specifier are selected.
+	{`on.0`, "on: [push]\n'on': x\n", map[string]interface{}{`true.0`: "push"}},
+	{`on`, "on: [push]\n'on': x\n", map[string]interface{}{`true`: []interface{}{"push"}, `"on"`: "x"}},
+	// Values are resolved as in YAML 1.1 as well, unless they are quoted or tagged.
+	{`*=true`, "a: yes\nb: On\nc: 'yes'\nd: !!str on\ne: true\nf: n\n", map[string]interface{}{`"a"`: true, `"b"`: true, `"e"`: true}},
+	{`*=false`, "a: no\nb: OFF\nc: \"no\"\nd: N\n", map[string]interface{}{`"a"`: false, `"b"`: false, `"d"`: false}},
+	{`*.enabled=true..name`, "- name: a\n  enabled: yes\n- name: b\n  enabled: 'yes'\n", map[string]interface{}{`0."name"`: "a"}},
+	{`*.on=false`, "- on: off\n- on: on\n", map[string]interface{}{`0.true`: false}},
+}
+
+const manifestsYAML = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Deployment of the web server.
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-server
+---
+kind: Deployment
+metadata:
+  name: worker
+`
+
+var testTabYAMLStream = testTab{
+	{`*.kind=Deployment..metadata.name`, manifestsYAML, map[string]interface{}{`1."metadata"."name"`: "web-server", `2."metadata"."name"`: "worker"}},
+	{`0.kind`, manifestsYAML, map[string]interface{}{`0."kind"`: "Service"}},
+	{`*.kind | count_by()`, manifestsYAML, map[string]interface{}{``: map[string]interface{}{"Deployment": 2.0, "Service": 1.0}}},
+	{`kind`, "kind: Service\n", map[string]interface{}{`"kind"`: "Service"}},
+	{`kind`, "---\nkind: Service\n", map[string]interface{}{`"kind"`: "Service"}},
+}
+
+// streamsRunner decodes every YAML document as a stream, even if it has a single document.
+var streamsRunner = NewRunner(Options{YAMLStreams: true})
+
+var testTabYAMLStreams = testTab{
+	{`*.kind=Deployment..metadata.name`, manifestsYAML, map[string]interface{}{`1."metadata"."name"`: "web-server", `2."metadata"."name"`: "worker"}},
+	{`*.kind=Deployment..metadata.name`, "---\nkind: Deployment\nmetadata:\n  name: web\n", map[string]interface{}{`0."metadata"."name"`: "web"}},
+	{`*.kind`, "kind: Service\n", map[string]interface{}{`0."kind"`: "Service"}},
+	{`kind`, "kind: Service\n", map[string]interface{}{}},
+}
+
+type mutationTestTab []struct {
+	query    string
+	source   string
+	mutation func(root interface{}, query string) (interface{}, error)
+	expected string
+}
+
+func setTo(value interface{}) func(interface{}, string) (interface{}, error) {
+	return func(root interface{}, query string) (interface{}, error) {
+		return Set(root, query, value)
+	}
+}
+
+func appendSuffix(root interface{}, query string) (interface{}, error) {
+	return Update(root, query, func(e Element) (interface{}, error) {
+		return fmt.Sprintf("%v-suffix", e.Value), nil
+	})
+}
+
+var testTabJSONMutation = mutationTestTab{
+	{`a`, `{"a": 1, "b": 2}`, setTo(3.0), `{"a": 3, "b": 2}`},
+	{`*`, `{"a": 1, "b": 2}`, setTo("x"), `{"a": "x", "b": "x"}`},
+	{`c`, `{"a": 1, "b": 2}`, setTo(3.0), `{"a": 1, "b": 2}`},
+	{``, `{"a": 1, "b": 2}`, setTo("root"), `"root"`},
+	{`**=1`, `{"a": [1, 2, {"b": 1}]}`, setTo(0.0), `{"a": [0, 2, {"b": 0}]}`},
+	{`a.1`, `{"a": [1, 2, 3]}`, Delete, `{"a": [1, 3]}`},
+	{`a.*!=2`, `{"a": [1, 2, 3, 2, 4]}`, Delete, `{"a": [2, 2]}`},
+	{`*`, `[1, [2, 3], 4]`, Delete, `[]`},
+	{`**=3`, `[1, [2, 3], 3, {"x": 3}]`, Delete, `[1, [2], {}]`},
+	{`**.x.`, `[{"x": 1}, {"y": [{"x": 2}]}]`, Delete, `[{"y": []}]`},
+	{`b`, `{"a": 1, "b": 2}`, Delete, `{"a": 1}`},
+	{``, `{"a": 1, "b": 2}`, Delete, `null`},
+	{`*.name`, `[{"name": "a"}, {"name": "b"}]`, appendSuffix, `[{"name": "a-suffix"}, {"name": "b-suffix"}]`},
+}
+
+func runMutationTests(t *testing.T, tab mutationTestTab, unmarshal func([]byte, interface{}) error) {
+	for index, entry := range tab {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			var root, expected interface{}
+			if err := unmarshal([]byte(entry.source), &root); err != nil {
+				t.Fatal(err)
+			}
+			if err := unmarshal([]byte(entry.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := entry.mutation(root, entry.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(result, expected) {
+				t.Errorf("Unexpected result of query `%s`: `%#v` instead of `%#v`", entry.query, result, expected)
+			}
+		})
+	}
+}
+
+var testTabYAMLMutation = mutationTestTab{
+	{`on.1`, complexYAML, Delete, strings.Replace(complexYAML, `[push, pull_request]`, `[push]`, 1)},
+	{`jobs.build.steps.*.name=Build.`, complexYAML, Delete, strings.Replace(complexYAML, "    - name: Build\n      run: go build -v ./...\n", "", 1)},
+	{`**.go-version`, complexYAML, setTo(1.14), strings.Replace(complexYAML, `go-version: 1.13`, `go-version: 1.14`, 1)},
+	{`1`, "1: one\n2: two", setTo("uno"), "1: uno\n2: two"},
 }
 
 func runTests(t *testing.T, tab testTab, verboseName bool, runFunc func(string, string) (map[string]Element, error)) {
@@ -296,10 +588,11 @@ func runTests(t *testing.T, tab testTab, verboseName bool, runFunc func(string,
 			// 	}
 			// }
 
+			// Expected values are either the exact values or, if they are written as plain values, the plain values.
 			for k, expected := range results {
 				if reality, exists := entry.results[k]; !exists {
 					t.Errorf("Expected element path `%s` missing from results -- %v", k, results)
-				} else if !cmp.Equal(reality, expected.Value) {
+				} else if !cmp.Equal(reality, expected.Value) && !cmp.Equal(reality, Plain(expected.Value)) {
 					t.Errorf("Unexpected value of result with path `%s`: `%#v` (%T) instead of `%#v` (%T)", k, reality, reality, expected, expected)
 				}
 			}
@@ -307,6 +600,16 @@ func runTests(t *testing.T, tab testTab, verboseName bool, runFunc func(string,
 	}
 }
 
+func runErrorTests(t *testing.T, tab testTab, runFunc func(string, string) (map[string]Element, error)) {
+	for index, entry := range tab {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			if _, err := runFunc(entry.query, entry.source); err == nil {
+				t.Errorf("Query `%s` was expected to fail", entry.query)
+			}
+		})
+	}
+}
+
 func runTestsJSON(t *testing.T, tab testTab, verboseName bool) {
 	runTests(t, tab, verboseName, RunJsonString)
 }
@@ -339,6 +642,913 @@ func TestRunJSONRegexInverted(t *testing.T) {
 	runTestsJSON(t, testTabJSONRegexInverted, false)
 }
 
+func TestRunJSONGroupBy(t *testing.T) {
+	runTestsJSON(t, testTabJSONGroupBy, false)
+}
+
+func TestRunJSONFunctions(t *testing.T) {
+	runTestsJSON(t, testTabJSONFunctions, false)
+}
+
+func TestRunJSONFunctionErrors(t *testing.T) {
+	runErrorTests(t, testTabJSONFunctionErrors, RunJsonString)
+}
+
+func TestRunJSONDateTime(t *testing.T) {
+	runTestsJSON(t, testTabJSONDateTime, false)
+}
+
+func TestRunJSONSemver(t *testing.T) {
+	runTestsJSON(t, testTabJSONSemver, false)
+}
+
+func TestRunJSONIP(t *testing.T) {
+	runTestsJSON(t, testTabJSONIP, false)
+}
+
+func TestJSONMutation(t *testing.T) {
+	runMutationTests(t, testTabJSONMutation, json.Unmarshal)
+}
+
+func TestMutationErrors(t *testing.T) {
+	for _, query := range []string{
+		`*.name | upper()`,
+		`* | count_by(name)`,
+		`* | group_by(name) | *.*.name`,
+		`*.name~(`,
+	} {
+		var root interface{}
+		if err := json.Unmarshal([]byte(`[{"name": "a"}, {"name": "b"}]`), &root); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Set(root, query, "x"); err == nil {
+			t.Errorf("Modifying query `%s` was expected to fail", query)
+		}
+		if _, err := Delete(root, query); err == nil {
+			t.Errorf("Deleting query `%s` was expected to fail", query)
+		}
+	}
+}
+
+const commentedYAML = `# Service configuration.
+service:
+  name: "web" # Quoted on purpose.
+  replicas: 2
+  ports: &ports
+    - 80
+    - 443
+  # Deprecated, to be removed.
+  legacy: true
+backup:
+  <<: {replicas: 1}
+  ports: *ports
+`
+
+var testTabYAMLRoundTrip = mutationTestTab{
+	{`service.replicas`, commentedYAML, setTo(3), strings.Replace(commentedYAML, `replicas: 2`, `replicas: 3`, 1)},
+	{`service.name`, commentedYAML, setTo("api"), strings.Replace(commentedYAML, `"web"`, `"api"`, 1)},
+	{`service.legacy`, commentedYAML, Delete, strings.Replace(commentedYAML, "  # Deprecated, to be removed.\n  legacy: true\n", "", 1)},
+	{`service.ports.1`, commentedYAML, Delete, strings.Replace(commentedYAML, "    - 443\n", "", 1)},
+	{`backup.replicas`, commentedYAML, setTo(2), strings.Replace(commentedYAML, "  ports: *ports\n", "  ports: *ports\n  replicas: 2\n", 1)},
+	{`*.kind=Deployment..metadata.name`, manifestsYAML, appendSuffix, strings.Replace(strings.Replace(manifestsYAML, "web-server", "web-server-suffix", 1), "worker", "worker-suffix", 1)},
+	{`0`, manifestsYAML, Delete, manifestsYAML[strings.Index(manifestsYAML, "# Deployment"):]},
+	{`1.metadata`, manifestsYAML, setTo("none"), strings.Replace(manifestsYAML, "metadata:\n  name: web-server", "metadata: none", 1)},
+	{``, manifestsYAML, setTo("none"), "none\n"},
+	{`backup.ports`, commentedYAML, setTo("none"), strings.Replace(commentedYAML, "ports: *ports", "ports: none", 1)},
+	{`on.0`, "on: [push]\n", setTo("pull_request"), "on: [pull_request]\n"},
+	{`on`, "'on': x\n", setTo("y"), "'on': \"y\"\n"},
+	{`enabled`, "enabled: true\n", setTo("yes"), "enabled: \"yes\"\n"},
+	{`enabled`, "enabled: 'no'\n", setTo("yes"), "enabled: 'yes'\n"},
+	{`enabled`, "enabled: no\n", setTo(true), "enabled: true\n"},
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	for index, entry := range testTabYAMLRoundTrip {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			doc, err := DecodeYaml(strings.NewReader(entry.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			root, err := entry.mutation(doc, entry.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sb := strings.Builder{}
+			if err := EncodeYaml(&sb, root); err != nil {
+				t.Fatal(err)
+			}
+
+			if sb.String() != entry.expected {
+				t.Errorf("Unexpected result of query `%s`:\n%s\ninstead of:\n%s", entry.query, sb.String(), entry.expected)
+			}
+		})
+	}
+}
+
+func TestYAMLAliases(t *testing.T) {
+	doc, err := DecodeYaml(strings.NewReader(commentedYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values reached through aliases and merge keys are shared with the anchored values.
+	for _, query := range []string{`backup.ports.0`, `**=443`} {
+		if _, err := Set(doc, query, 8080); err == nil {
+			t.Errorf("Query `%s` modified a value through an alias", query)
+		}
+		if _, err := Delete(doc, query); err == nil {
+			t.Errorf("Query `%s` deleted a value through an alias", query)
+		}
+	}
+
+	// Modified anchored values are modified in their aliases as well.
+	if _, err := Delete(doc, `service.ports.1`); err != nil {
+		t.Fatal(err)
+	}
+	results, err := Run(`backup.ports.*`, doc)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 || results[`"backup"."ports".0`].Value != 80 {
+		t.Errorf("Unexpected results: %v", results)
+	}
+}
+
+// plainRunner decodes JSON into the same types as encoding/json.
+var plainRunner = NewRunner(Options{PlainJSON: true})
+
+var testTabDocumentOrder = []struct {
+	query  string
+	source string
+	run    func(string, string) (map[string]Element, error)
+	paths  []string
+}{
+	{`*`, `{"z": 1, "a": 2, "m": 3}`, RunJsonString, []string{`"z"`, `"a"`, `"m"`}},
+	{`**`, `{"z": [1, {"y": 2, "b": 3}], "a": 4}`, RunJsonString, []string{``, `"z"`, `"z".0`, `"z".1`, `"z".1."y"`, `"z".1."b"`, `"a"`}},
+	// Keys of unordered maps are ordered alphabetically.
+	{`*`, `{"z": 1, "a": 2, "m": 3}`, plainRunner.RunJsonString, []string{`"a"`, `"m"`, `"z"`}},
+	{`*.*`, `[[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11], [0]]`, RunJsonString, []string{`0.0`, `0.1`, `0.2`, `0.3`, `0.4`, `0.5`, `0.6`, `0.7`, `0.8`, `0.9`, `0.10`, `1.0`}},
+	{`**.name`, complexYAML, RunYamlString, []string{`"name"`, `"jobs"."build"."name"`, `"jobs"."build"."steps".0."name"`, `"jobs"."build"."steps".1."name"`, `"jobs"."build"."steps".2."name"`, `"jobs"."build"."steps".3."name"`, `"jobs"."build"."steps".4."name"`}},
+}
+
+func TestDocumentOrder(t *testing.T) {
+	for index, entry := range testTabDocumentOrder {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			results, err := entry.run(entry.query, entry.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			paths := []string{}
+			for _, e := range Sorted(results) {
+				paths = append(paths, e.GetFullPath())
+			}
+
+			if !cmp.Equal(paths, entry.paths) {
+				t.Errorf("Unexpected order of results: %v instead of %v", paths, entry.paths)
+			}
+		})
+	}
+}
+
+type reflectAddress struct {
+	City    string `json:"city"`
+	Country string `yaml:"country"`
+}
+
+type reflectStatus string
+
+type reflectUser struct {
+	reflectAddress
+	Name     string               `json:"name"`
+	Age      int32                `json:"age,omitempty"`
+	Status   reflectStatus        `json:"status"`
+	Country  string               `json:"country"`
+	Password string               `json:"-"`
+	Manager  *reflectUser         `json:"manager,omitempty"`
+	Tags     []string             `json:"tags"`
+	Limits   map[string]uint16    `json:"limits"`
+	Scores   [2]float32           `json:"scores"`
+	Address  net.IP               `json:"address"`
+	Joined   time.Time            `json:"joined"`
+	Extra    map[int]interface{}  `json:"extra,omitempty"`
+	Settings *map[string][]string `json:"settings"`
+	internal string
+}
+
+var reflectUsers = []*reflectUser{
+	{
+		reflectAddress: reflectAddress{City: "Prague", Country: "CZ"},
+		Name:           "alice",
+		Age:            30,
+		Status:         "active",
+		Password:       "secret",
+		Tags:           []string{"admin", "dev"},
+		Limits:         map[string]uint16{"cpu": 4, "memory": 16},
+		Scores:         [2]float32{1.5, 2},
+		Address:        net.ParseIP("10.0.0.1"),
+		Joined:         time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Extra:          map[int]interface{}{7: map[string]interface{}{"lucky": true}},
+		internal:       "hidden",
+	},
+	{
+		reflectAddress: reflectAddress{City: "Brno"},
+		Name:           "bob",
+		Status:         "disabled",
+		Country:        "SK",
+		Address:        net.ParseIP("192.168.1.1"),
+		Joined:         time.Date(2019, 6, 30, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func init() {
+	reflectUsers[1].Manager = reflectUsers[0]
+}
+
+var testTabReflection = testTab{
+	{`*.name`, ``, map[string]interface{}{`0."name"`: "alice", `1."name"`: "bob"}},
+	// Fields of embedded structs are promoted, unless they are shadowed.
+	{`*.city`, ``, map[string]interface{}{`0."city"`: "Prague", `1."city"`: "Brno"}},
+	{`*.country`, ``, map[string]interface{}{`0."country"`: "", `1."country"`: "SK"}},
+	// Ignored, unexported and empty fields with omitempty are skipped.
+	{`*.Password`, ``, map[string]interface{}{}},
+	{`*.internal`, ``, map[string]interface{}{}},
+	{`*.age`, ``, map[string]interface{}{`0."age"`: 30}},
+	// Scalars are converted, so filters and functions understand them.
+	{`*.status=active..name`, ``, map[string]interface{}{`0."name"`: "alice"}},
+	{`*.age@ge(18)..name`, ``, map[string]interface{}{`0."name"`: "alice"}},
+	{`*.address@cidr_in(10.0.0.0/8)..name`, ``, map[string]interface{}{`0."name"`: "alice"}},
+	{`*.joined@>=2020-01-01..name`, ``, map[string]interface{}{`0."name"`: "alice"}},
+	{`0.limits.memory`, ``, map[string]interface{}{`0."limits"."memory"`: uint64(16)}},
+	{`0.scores.*`, ``, map[string]interface{}{`0."scores".0`: 1.5, `0."scores".1`: 2.0}},
+	{`0.tags.* | upper()`, ``, map[string]interface{}{`0."tags".0`: "ADMIN", `0."tags".1`: "DEV"}},
+	{`0.extra.7.lucky`, ``, map[string]interface{}{`0."extra".7."lucky"`: true}},
+	// Pointers are followed, nil pointers are null.
+	{`1.manager.name`, ``, map[string]interface{}{`1."manager"."name"`: "alice"}},
+	{`*.settings`, ``, map[string]interface{}{`0."settings"`: nil, `1."settings"`: nil}},
+	{`*.manager.name...name`, ``, map[string]interface{}{`1."name"`: "bob"}},
+}
+
+func TestRunReflection(t *testing.T) {
+	runTests(t, testTabReflection, false, func(query string, _ string) (map[string]Element, error) {
+		return Run(query, reflectUsers)
+	})
+
+	// Struct fields are in declaration order (promoted fields in place of their embedded structs).
+	results, err := Run(`0.*`, reflectUsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+	for _, e := range Sorted(results) {
+		paths = append(paths, e.GetFullPath())
+	}
+	expected := []string{`0."city"`, `0."name"`, `0."age"`, `0."status"`, `0."country"`, `0."tags"`, `0."limits"`,
+		`0."scores"`, `0."address"`, `0."joined"`, `0."extra"`, `0."settings"`}
+	if !cmp.Equal(paths, expected) {
+		t.Errorf("Unexpected order of struct fields: %v", paths)
+	}
+}
+
+// reflectTree has cycles through the parents of its nodes.
+type reflectTree struct {
+	Name   string         `json:"name"`
+	Parent *reflectTree   `json:"parent"`
+	Kids   []*reflectTree `json:"kids"`
+}
+
+func newReflectTree() *reflectTree {
+	root := &reflectTree{Name: "root"}
+	root.Kids = []*reflectTree{{Name: "kid", Parent: root}, {Name: "other", Parent: root}}
+	root.Kids[0].Kids = []*reflectTree{{Name: "kid", Parent: root.Kids[0]}}
+	return root
+}
+
+var reflectKeys = map[string]interface{}{
+	"ints":   map[int]string{1: "a", 10: "b", 2: "c", -3: "d"},
+	"uints":  map[uint8]string{200: "a", 3: "b"},
+	"floats": map[float64]string{1.5: "a", 0.5: "b"},
+	"bools":  map[bool]string{true: "a", false: "b"},
+	"mixed":  map[interface{}]interface{}{1: "a", "1": "b", 2: "c"},
+	"typed":  map[interface{}]string{1: "a", "1": "b", 2: "c"},
+}
+
+var testTabReflectionKeys = testTab{
+	{`ints.10`, ``, map[string]interface{}{`"ints".10`: "b"}},
+	{`ints.-3`, ``, map[string]interface{}{`"ints".-3`: "d"}},
+	{`ints.010`, ``, map[string]interface{}{}},
+	{`ints.x`, ``, map[string]interface{}{}},
+	{`uints.200`, ``, map[string]interface{}{`"uints".0xc8`: "a"}},
+	{`uints.300`, ``, map[string]interface{}{}},
+	{`floats.1.5`, ``, map[string]interface{}{}},
+	{`floats."1.5"`, ``, map[string]interface{}{`"floats".1.5`: "a"}},
+	{`bools.on`, ``, map[string]interface{}{`"bools".true`: "a"}},
+	{`bools.false`, ``, map[string]interface{}{`"bools".false`: "b"}},
+	// All keys matching the specifier are selected.
+	{`mixed.1`, ``, map[string]interface{}{`"mixed".1`: "a", `"mixed"."1"`: "b"}},
+	{`typed.1`, ``, map[string]interface{}{`"typed".1`: "a", `"typed"."1"`: "b"}},
+}
+
+func TestRunReflectionKeys(t *testing.T) {
+	runTests(t, testTabReflectionKeys, false, func(query string, _ string) (map[string]Element, error) {
+		return Run(query, reflectKeys)
+	})
+
+	// Numeric keys are ordered numerically.
+	results, err := Run(`ints.*`, reflectKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []interface{}{}
+	for _, e := range Sorted(results) {
+		values = append(values, e.Value)
+	}
+	if expected := []interface{}{"d", "a", "c", "b"}; !cmp.Equal(values, expected) {
+		t.Errorf("Unexpected order of numeric keys: %v", values)
+	}
+}
+
+func TestRunReflectionCycles(t *testing.T) {
+	// Parents of the nodes are their ancestors, so they are left out instead of being traversed again.
+	results, err := Run(`**.name=kid`, newReflectTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{}
+	for _, e := range Sorted(results) {
+		paths = append(paths, e.GetFullPath())
+	}
+	if expected := []string{`"kids".0."name"`, `"kids".0."kids".0."name"`}; !cmp.Equal(paths, expected) {
+		t.Errorf("Unexpected results of a query on a cyclic value: %v", paths)
+	}
+
+	if results, err := Run(`kids.0.parent`, newReflectTree()); err != nil || len(results) != 0 {
+		t.Errorf("Cyclic parent was selected: %v (%v)", results, err)
+	}
+}
+
+// tableNode is a lazy source of rows, which counts the rows it has loaded.
+type tableNode struct {
+	columns []string
+	rows    [][]interface{}
+	loaded  *int
+}
+
+type rowNode struct {
+	table *tableNode
+	index int
+}
+
+type cellNode struct {
+	row    rowNode
+	column int
+}
+
+func (n *tableNode) Kind() NodeKind     { return SequenceNode }
+func (n *tableNode) Value() interface{} { return nil }
+func (n *tableNode) Key() interface{}   { return nil }
+func (n *tableNode) Parent() Node       { return nil }
+
+func (n *tableNode) Children() []Node {
+	children := []Node{}
+	for i := range n.rows {
+		children = append(children, n.row(i))
+	}
+	return children
+}
+
+func (n *tableNode) Lookup(spec string) []Node {
+	if index, err := strconv.Atoi(spec); err == nil && index >= 0 && index < len(n.rows) {
+		return []Node{n.row(index)}
+	}
+	return nil
+}
+
+func (n *tableNode) row(index int) Node {
+	*n.loaded++
+	return rowNode{n, index}
+}
+
+func (n rowNode) Kind() NodeKind     { return MappingNode }
+func (n rowNode) Value() interface{} { return nil }
+func (n rowNode) Key() interface{}   { return n.index }
+func (n rowNode) Parent() Node       { return n.table }
+func (n rowNode) Index() int         { return n.index }
+
+func (n rowNode) Children() []Node {
+	children := []Node{}
+	for i := range n.table.columns {
+		children = append(children, cellNode{n, i})
+	}
+	return children
+}
+
+func (n rowNode) Lookup(spec string) []Node {
+	for i, column := range n.table.columns {
+		if column == spec {
+			return []Node{cellNode{n, i}}
+		}
+	}
+	return nil
+}
+
+func (n cellNode) Kind() NodeKind       { return ScalarNode }
+func (n cellNode) Children() []Node     { return nil }
+func (n cellNode) Lookup(string) []Node { return nil }
+func (n cellNode) Value() interface{}   { return n.row.table.rows[n.row.index][n.column] }
+func (n cellNode) Key() interface{}     { return n.row.table.columns[n.column] }
+func (n cellNode) Parent() Node         { return n.row }
+
+func TestRunNode(t *testing.T) {
+	loaded := 0
+	table := &tableNode{
+		columns: []string{"name", "debt", "tags"},
+		rows: [][]interface{}{
+			{"John Doe", 1000, []interface{}{"a"}},
+			{"Jane Doe", 0, []interface{}{"b", "c"}},
+			{"Robert Denver", 0, nil},
+		},
+		loaded: &loaded,
+	}
+
+	runTests(t, testTab{
+		{`*.debt=0..name`, ``, map[string]interface{}{`1."name"`: "Jane Doe", `2."name"`: "Robert Denver"}},
+		{`1.tags.*`, ``, map[string]interface{}{`1."tags".0`: "b", `1."tags".1`: "c"}},
+		{`* | count_by(debt)`, ``, map[string]interface{}{``: map[string]interface{}{"0": 2.0, "1000": 1.0}}},
+	}, false, func(query string, _ string) (map[string]Element, error) {
+		return Run(query, table)
+	})
+
+	// Values of container nodes are the nodes themselves, which can be converted to maps and arrays.
+	expected := map[string]interface{}{"name": "John Doe", "debt": 1000, "tags": []interface{}{"a"}}
+	if results, err := Run(`0`, table); err != nil {
+		t.Fatal(err)
+	} else if value := Plain(results[`0`].Value); !cmp.Equal(value, expected) {
+		t.Errorf("Unexpected value of row: %#v instead of %#v", value, expected)
+	}
+
+	// Nodes are only loaded when they are needed, even to order the results (rows know their indexes).
+	loaded = 0
+	if results, err := Run(`users.2.name`, map[string]interface{}{"users": table}); err != nil {
+		t.Fatal(err)
+	} else if sorted := Sorted(results); len(sorted) != 1 || loaded != 1 {
+		t.Errorf("Unexpected results %v with %d loaded rows", sorted, loaded)
+	}
+}
+
+type decodedUser struct {
+	Name string  `json:"name" yaml:"full_name"`
+	Debt float64 `json:"debt" yaml:"owes"`
+}
+
+// jsonUser has json tags only, like types shared with JSON APIs.
+type jsonUser struct {
+	Name  string          `json:"full_name"`
+	Flags map[string]bool `json:"flags"`
+}
+
+func TestDecode(t *testing.T) {
+	doc, err := DecodeJson(strings.NewReader(complexJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []decodedUser{}
+	if err := QueryAll(`*.debt=0.`, doc, &users); err != nil {
+		t.Fatal(err)
+	} else if !cmp.Equal(users, []decodedUser{{"John Daniel", 0}, {"Robert Denver", 0}}) {
+		t.Errorf("Unexpected decoded users: %+v", users)
+	}
+
+	var debt int
+	if err := QueryOne(`0.debt`, doc, &debt); err != nil {
+		t.Fatal(err)
+	} else if debt != 1000 {
+		t.Errorf("Unexpected decoded debt: %d", debt)
+	}
+
+	// Elements of YAML documents are decoded using yaml tags.
+	yamlDoc, err := DecodeYaml(strings.NewReader("- full_name: Alice\n  owes: 12.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := decodedUser{}
+	if err := QueryOne(`0`, yamlDoc, &user); err != nil {
+		t.Fatal(err)
+	} else if user != (decodedUser{"Alice", 12.5}) {
+		t.Errorf("Unexpected decoded YAML user: %+v", user)
+	}
+
+	// Targets with json tags only are decoded using them, even from YAML documents.
+	flagsDoc, err := DecodeYaml(strings.NewReader("full_name: Bob\nflags: {on: true, admin: false}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOnly := jsonUser{}
+	if err := QueryOne(``, flagsDoc, &jsonOnly); err != nil {
+		t.Fatal(err)
+	} else if expected := (jsonUser{"Bob", map[string]bool{"true": true, "admin": false}}); !cmp.Equal(jsonOnly, expected) {
+		t.Errorf("Unexpected decoded YAML user with json tags: %+v", jsonOnly)
+	}
+
+	names := []string{}
+	if results, err := Run(`*.name | upper()`, doc); err != nil {
+		t.Fatal(err)
+	} else if err := Decode(results, &names); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(names, ",") != "JOHN DOE,JANE DOE,JOHN DANIEL,ROBERT DENVER,CLARK DENVER" {
+		t.Errorf("Unexpected decoded names: %v", names)
+	}
+
+	for _, entry := range []struct {
+		query  string
+		root   interface{}
+		target interface{}
+		err    string
+	}{
+		{`0.name`, doc, new(int), "unable to decode result `0.\"name\"`: json: cannot unmarshal string into Go value of type int"},
+		{`*.name`, doc, new(string), "has 5 results instead of exactly one"},
+		{`nothing`, doc, new(string), "has 0 results instead of exactly one"},
+		{`0.full_name`, yamlDoc, new(int), "unable to decode result `0.\"full_name\"`: yaml: unmarshal errors:"},
+	} {
+		if err := QueryOne(entry.query, entry.root, entry.target); err == nil || !strings.Contains(err.Error(), entry.err) {
+			t.Errorf("Query `%s` returned error %v instead of %q", entry.query, err, entry.err)
+		}
+	}
+
+	if err := QueryAll(`*.name`, doc, new(string)); err == nil {
+		t.Error("Results were decoded into a value which is not a slice")
+	}
+}
+
+// envFormat is a format of environment files (KEY=value lines), registered by a test.
+type envFormat struct{}
+
+func (envFormat) Name() string           { return "env" }
+func (envFormat) Extensions() []string   { return []string{".env"} }
+func (envFormat) Sniff(head []byte) bool { return regexp.MustCompile(`^[A-Z_]+=`).Match(head) }
+
+func (envFormat) Decode(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root := map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		root[parts[0]] = parts[1]
+	}
+	return root, nil
+}
+
+func (envFormat) Encode(w io.Writer, value interface{}) error {
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unable to encode %T", value)
+	}
+	keys := []string{}
+	for key := range root {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s=%v\n", key, root[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterFormat(envFormat{})
+}
+
+func TestFormats(t *testing.T) {
+	for _, entry := range []struct {
+		path   string
+		head   string
+		format string
+	}{
+		{"a.json", "", "json"},
+		{"a.YML", "", "yaml"},
+		{"a.yaml", "{}", "yaml"},
+		{"prod.env", "", "env"},
+		{"data", "\xef\xbb\xbf  [1, 2]", "json"},
+		{"data", "\n{\"a\": 1}", "json"},
+		{"data", "# comment\nkind: Service\n", "yaml"},
+		{"data", "---\na: 1\n", "yaml"},
+		{"data", "- a\n- b\n", "yaml"},
+		{"data", "PATH=/bin\n", "env"},
+		{"data", "just text", ""},
+		{"data", "", ""},
+	} {
+		f, ok := DetectFormat(entry.path, []byte(entry.head))
+		if entry.format == "" && ok {
+			t.Errorf("Format of %s (%q) detected as %s", entry.path, entry.head, f.Name())
+		} else if entry.format != "" && (!ok || f.Name() != entry.format) {
+			t.Errorf("Format of %s (%q) not detected as %s", entry.path, entry.head, entry.format)
+		}
+	}
+
+	env, ok := FormatByName("ENV")
+	if !ok {
+		t.Fatal("Registered format not found")
+	}
+
+	results, err := RunFormat(`HOME`, env, strings.NewReader("HOME=/root\nUSER=root\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 || results[`"HOME"`].Value != "/root" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	root, err := env.Decode(strings.NewReader("HOME=/root\nUSER=root\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if root, err = Set(root, `USER`, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	sb := strings.Builder{}
+	if err := defaultRunner.Encode(env, &sb, root); err != nil {
+		t.Fatal(err)
+	} else if sb.String() != "HOME=/root\nUSER=admin\n" {
+		t.Errorf("Unexpected encoded document: %q", sb.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Format was registered twice")
+		}
+	}()
+	RegisterFormat(envFormat{})
+}
+
+func init() {
+	filters.RegisterPredicate("isEmail", func(value string) bool {
+		return regexp.MustCompile(`^[^@\s]+@[^@\s]+\.\w+$`).MatchString(value)
+	})
+	filters.RegisterPredicate("inAllowlist", func(value string, allowed ...string) bool {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+		return false
+	})
+	filters.RegisterPredicate("between", func(value float64, min float64, max float64) bool {
+		return value >= min && value <= max
+	})
+	functions.RegisterFunc("truncate", func(value string, length int) string {
+		if len(value) > length {
+			return value[:length]
+		}
+		return value
+	})
+	functions.RegisterFunc("half", func(value int) (int, error) {
+		if value%2 != 0 {
+			return 0, fmt.Errorf("%d is odd", value)
+		}
+		return value / 2, nil
+	})
+}
+
+const contactsJSON string = `[
+	{"name": "alice", "email": "alice@example.com", "age": 30},
+	{"name": "bob", "email": "bob at example.com", "age": 17},
+	{"name": "carol", "email": "carol@example.org", "age": 64}
+]`
+
+var testTabJSONRegistry = testTab{
+	{`*.email@isEmail..name`, contactsJSON, map[string]interface{}{`0."name"`: "alice", `2."name"`: "carol"}},
+	{`*.email!@isEmail..name`, contactsJSON, map[string]interface{}{`1."name"`: "bob"}},
+	{`*.name@inAllowlist(alice, "bob")`, contactsJSON, map[string]interface{}{`0."name"`: "alice", `1."name"`: "bob"}},
+	{`*.name@inAllowlist()`, contactsJSON, map[string]interface{}{}},
+	{`*.age@between(18, 64)..name`, contactsJSON, map[string]interface{}{`0."name"`: "alice", `2."name"`: "carol"}},
+	// Values of other types do not match.
+	{`*.name@between(0, 100)`, contactsJSON, map[string]interface{}{}},
+	{`*.name | truncate(3)`, contactsJSON, map[string]interface{}{`0."name"`: "ali", `1."name"`: "bob", `2."name"`: "car"}},
+	{`0.age | half()`, contactsJSON, map[string]interface{}{`0."age"`: 15}},
+}
+
+// Operands of filters may contain '@', keys containing it must be quoted or escaped.
+// Dots in operands still need to be quoted.
+var testTabJSONAtRune = testTab{
+	{`*.email="alice@example.com"..name`, contactsJSON, map[string]interface{}{`0."name"`: "alice"}},
+	{`*.email!="alice@example.com"..name`, contactsJSON, map[string]interface{}{`1."name"`: "bob", `2."name"`: "carol"}},
+	{`*.email~@example\.org$..name`, contactsJSON, map[string]interface{}{`2."name"`: "carol"}},
+	{`*.email~"^[a-z]+@example\.com$"..name`, contactsJSON, map[string]interface{}{`0."name"`: "alice"}},
+	{`*=root@localhost`, `{"to": "root@localhost", "cc": "root"}`, map[string]interface{}{`"to"`: "root@localhost"}},
+	{`"carol@example.org"`, `{"carol@example.org": "carol"}`, map[string]interface{}{`"carol@example.org"`: "carol"}},
+	{`carol\@example.org`, `{"carol@example": {"org": 1}}`, map[string]interface{}{`"carol@example"."org"`: 1.0}},
+}
+
+var testTabJSONRegistryErrors = testTab{
+	{`1.age | half()`, contactsJSON, nil},
+	{`0.age | truncate(3)`, contactsJSON, nil},
+}
+
+func TestRunJSONAtRune(t *testing.T) {
+	runTestsJSON(t, testTabJSONAtRune, false)
+}
+
+func TestRunJSONRegistry(t *testing.T) {
+	runTestsJSON(t, testTabJSONRegistry, false)
+	runErrorTests(t, testTabJSONRegistryErrors, RunJsonString)
+
+	// Unknown names and invalid arguments are reported when the query is parsed.
+	for _, query := range []string{
+		`*@isPhone`,
+		`*@between(1)`,
+		`*@between(a, b)`,
+		`* | truncate()`,
+		`* | truncate(x)`,
+		`* | shorten(3)`,
+	} {
+		if _, err := parser.ParsePipeline(query); err == nil {
+			t.Errorf("Query `%s` was parsed, although it is invalid", query)
+		}
+	}
+
+	for _, register := range []func(){
+		func() { filters.RegisterPredicate("isEmail", func(string) bool { return true }) },
+		func() { filters.RegisterPredicate("invalid-name", func(string) bool { return true }) },
+		func() { filters.RegisterPredicate("noBool", func(string) string { return "" }) },
+		func() { functions.RegisterFunc("upper", strings.ToUpper) },
+		func() { functions.RegisterFunc("noValue", func() string { return "" }) },
+		func() { functions.RegisterFunc("badArg", func(string, []string) string { return "" }) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Invalid registration did not panic")
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestRunJSONPath(t *testing.T) {
+	r := NewRunner(Options{Dialect: parser.JSONPathDialect})
+
+	// Other documents and Go values are queried the same way as JSON documents.
+	doc, err := DecodeYaml(strings.NewReader("items:\n  - {name: a, size: 3}\n  - {name: b, size: 12}\n  - {name: c}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []interface{}{doc, []reflectUser{{Name: "a", Age: 3}, {Name: "b", Age: 12}}} {
+		query := `$.items[?@.size > 2 && @.size < 10].name`
+		if _, ok := root.([]reflectUser); ok {
+			query = `$[?@.age > 2 && @.age < 10].name`
+		}
+
+		names := []string{}
+		if results, err := r.Run(query, root); err != nil {
+			t.Fatal(err)
+		} else if err := Decode(results, &names); err != nil {
+			t.Fatal(err)
+		} else if !cmp.Equal(names, []string{"a"}) {
+			t.Errorf("Query `%s` returned %v", query, names)
+		}
+	}
+
+	// Selectors and filter expressions cannot be streamed, so the document is decoded entirely.
+	streamed := []string{}
+	err = r.RunJsonStream(`$..[-1].name`, strings.NewReader(complexJSON), func(elem Element) error {
+		streamed = append(streamed, elem.Path())
+		return nil
+	})
+	if expected, _ := r.RunJsonString(`$..[-1].name`, complexJSON); err != nil || len(streamed) != len(expected) || len(expected) == 0 {
+		t.Errorf("Streamed query returned %v instead of %d results (%v)", streamed, len(expected), err)
+	}
+
+	// Streamed node lists are in the order of the selectors as well.
+	streamed = []string{}
+	err = r.RunJsonStream(`$..*`, strings.NewReader(`{"a": {"b": 1}, "c": [2]}`), func(elem Element) error {
+		streamed = append(streamed, elem.JSONPath())
+		return nil
+	})
+	if expected := []string{"$['a']", "$['c']", "$['a']['b']", "$['c'][0]"}; err != nil || !cmp.Equal(streamed, expected) {
+		t.Errorf("Streamed node list %v is not %v (%v)", streamed, expected, err)
+	}
+
+	// Embedded queries are restricted by the limits.
+	limited := NewRunner(Options{Dialect: parser.JSONPathDialect, Limits: Limits{MaxNodes: 10}})
+	if _, err := limited.RunJsonString(`$[?count(@..*) > 0]`, complexJSON); err == nil {
+		t.Error("Filter expression did not exceed the limit")
+	} else if limitErr := (&LimitError{}); !errors.As(err, &limitErr) || limitErr.Limit != NodesLimit {
+		t.Errorf("Unexpected limit error: %v", err)
+	}
+
+	if _, err := r.RunJsonString(`*.name`, complexJSON); err == nil {
+		t.Error("UniQuery query was accepted as JSONPath")
+	}
+
+	// Node lists are in the order of the selectors and repeat nodes, while other results are unique.
+	list, err := DecodeJson(strings.NewReader(`{"a": [1, 2, 3]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := r.RunNodes(`$.a[2, 0, 2, ::-2]`, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, node := range nodes {
+		paths = append(paths, node.JSONPath())
+	}
+	if expected := []string{"$['a'][2]", "$['a'][0]", "$['a'][2]", "$['a'][2]", "$['a'][0]"}; !cmp.Equal(paths, expected) {
+		t.Errorf("Node list %v is not %v", paths, expected)
+	}
+	if _, err := limited.RunNodes(`$..*`, list); err != nil {
+		t.Error(err)
+	} else if _, err := limited.RunNodes(`$..*..*..*`, list); err == nil {
+		t.Error("Node list did not exceed the limit")
+	}
+
+	nodes, err = NewRunner(Options{}).RunNodes(`a.*`, list)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(nodes) != 3 || Plain(nodes[0].Value) != 1.0 || Plain(nodes[2].Value) != 3.0 {
+		t.Errorf("Results are not in document order: %v", nodes)
+	}
+}
+
 func TestRunYAMLGeneral(t *testing.T) {
 	runTestsYAML(t, testTabYAMLGeneral, false)
 }
+
+func TestRunYAMLStream(t *testing.T) {
+	runTestsYAML(t, testTabYAMLStream, false)
+}
+
+func TestRunYAMLStreams(t *testing.T) {
+	runTests(t, testTabYAMLStreams, false, streamsRunner.RunYamlString)
+
+	// A stream of a single document is written back without an additional document marker.
+	doc, err := streamsRunner.DecodeYaml(strings.NewReader("kind: Service # web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := Set(doc, `0.kind`, "Deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := strings.Builder{}
+	if err := EncodeYaml(&sb, modified); err != nil {
+		t.Fatal(err)
+	} else if sb.String() != "kind: Deployment # web\n" {
+		t.Errorf("Unexpected encoded stream: %q", sb.String())
+	}
+}
+
+func TestYAMLMutation(t *testing.T) {
+	runMutationTests(t, testTabYAMLMutation, yaml.Unmarshal)
+}
+
+var testTabEncodeOptions = []struct {
+	options  Options
+	format   Format
+	expected string
+}{
+	{Options{Indent: 2}, JsonFormat, "{\n  \"a\": [\n    1\n  ]\n}\n"},
+	{Options{}, JsonFormat, "{\n    \"a\": [\n        1\n    ]\n}\n"},
+	{Options{Indent: 2}, YamlFormat, "a:\n  - 1\n"},
+}
+
+func TestRunnerOptions(t *testing.T) {
+	logs := strings.Builder{}
+	verbose := NewRunner(Options{Verbose: true, Logger: log.New(&logs, "", 0)})
+	quiet := NewRunner(Options{})
+
+	if _, err := verbose.RunJsonString(`name`, `{"name": "a"}`); err != nil {
+		t.Fatal(err)
+	} else if _, err := quiet.RunJsonString(`name`, `{"name": "a"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if logs.String() != "Parsed query: [{Parts:[{Specifier:name Filters:[] Literal:false Selectors:[]}] Call:<nil>}]\n" {
+		t.Errorf("Unexpected verbose output: %q", logs.String())
+	}
+
+	for index, entry := range testTabEncodeOptions {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			sb := strings.Builder{}
+			if err := NewRunner(entry.options).Encode(entry.format, &sb, map[string]interface{}{"a": []interface{}{1}}); err != nil {
+				t.Fatal(err)
+			} else if sb.String() != entry.expected {
+				t.Errorf("Unexpected encoded value: %q instead of %q", sb.String(), entry.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/natiiix/uniquery/pkg/filters"
+	"github.com/natiiix/uniquery/pkg/parser"
+)
+
+// streamStates are the states of the query evaluation at a value. Apply states are indices of query parts,
+// which are yet to be applied to the value (an index past the last part means the value is a result).
+// Selected states are indices of parts, which have selected the value, but whose filters have not been checked yet.
+type streamStates struct {
+	apply    []int
+	selected []int
+}
+
+func containsState(states []int, state int) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func addState(states []int, state int) []int {
+	if containsState(states, state) {
+		return states
+	}
+	return append(states, state)
+}
+
+// jsonStream evaluates a forward-only query on a JSON token stream. Values are decoded only if they are results
+// or if filters have to be checked on them, everything else is skipped without being decoded.
+type jsonStream struct {
+	decoder *jsonDecoder
+	parts   []parser.QueryPart
+	// calls are functions applied to the results.
+	calls []*parser.Call
+	emit  func(Element) error
+	eval  *evaluation
+	// emitted contains the paths of emitted results, if the query can select an element repeatedly.
+	emitted map[string]bool
+}
+
+// isStreamable checks whether the pipeline can be evaluated on a stream. The first stage must be a query
+// without parent navigation, which would require values preceding the current one. JSONPath selectors and filter
+// expressions are not supported either. It may be followed only by functions.
+func isStreamable(stages []parser.Stage) bool {
+	for i, stage := range stages {
+		if i == 0 {
+			if stage.Call != nil {
+				return false
+			}
+			for _, part := range stage.Parts {
+				if part.IsParent() || len(part.Selectors) > 0 || hasContextFilter(part.Filters) {
+					return false
+				}
+			}
+		} else if stage.Call == nil {
+			return false
+		} else if _, isOperator := operators[stage.Call.Name]; isOperator {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolve expands the states of a value. Selected states without filters continue with the next part
+// and a recursive part (`**`) also selects the value itself. Selected states with filters are kept,
+// because the filters have to be checked on the value. The second return value is true if the value is a result.
+func (s *jsonStream) resolve(states streamStates) (streamStates, bool) {
+	resolved := streamStates{}
+	queue := append([]int{}, states.apply...)
+
+	for _, i := range states.selected {
+		if len(s.parts[i].Filters) > 0 {
+			resolved.selected = addState(resolved.selected, i)
+		} else {
+			queue = append(queue, i+1)
+		}
+	}
+
+	for len(queue) > 0 {
+		j := queue[0]
+		queue = queue[1:]
+
+		if containsState(resolved.apply, j) {
+			continue
+		}
+		resolved.apply = append(resolved.apply, j)
+
+		if j < len(s.parts) && s.parts[j].IsRecursive() {
+			if len(s.parts[j].Filters) > 0 {
+				resolved.selected = addState(resolved.selected, j)
+			} else {
+				queue = append(queue, j+1)
+			}
+		}
+	}
+
+	return resolved, containsState(resolved.apply, len(s.parts))
+}
+
+// containerMatch checks the filters on an object or array without decoding it.
+// The second return value is false if the match depends on the content of the container.
+func containerMatch(valueFilters []filters.Filter) (bool, bool) {
+	for _, filter := range valueFilters {
+		if matches, known := filters.MatchesContainers(filter); !known {
+			return false, false
+		} else if !matches {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// resolveContainer checks the filters of the selected states on an object or array, whose content has not been read.
+// States whose filters match continue with the next part (see resolve), the others are dropped.
+// The second return value is false if some filters depend on the content, so the container must be decoded.
+func (s *jsonStream) resolveContainer(states streamStates) (streamStates, bool) {
+	checked := []int{}
+	for {
+		apply := append([]int{}, states.apply...)
+		for _, i := range states.selected {
+			if containsState(checked, i) {
+				continue
+			}
+			checked = append(checked, i)
+
+			if matches, known := containerMatch(s.parts[i].Filters); !known {
+				return states, false
+			} else if matches {
+				apply = append(apply, i+1)
+			}
+		}
+
+		resolved, _ := s.resolve(streamStates{apply: apply})
+		unchecked := false
+		for _, i := range resolved.selected {
+			unchecked = unchecked || !containsState(checked, i)
+		}
+
+		states = streamStates{apply: resolved.apply}
+		if !unchecked {
+			return states, true
+		}
+		states.selected = resolved.selected
+	}
+}
+
+// childStates determines the states of the child with the specified key.
+func (s *jsonStream) childStates(states streamStates, key interface{}) streamStates {
+	child := streamStates{}
+
+	for _, j := range states.apply {
+		if j == len(s.parts) {
+			continue
+		}
+
+		switch part := s.parts[j]; {
+		case part.IsRecursive():
+			child.apply = addState(child.apply, j)
+		case part.IsWildcard():
+			child.selected = addState(child.selected, j)
+		default:
+			spec := part.Specifier
+			if keyStr, ok := key.(string); ok && keyStr == spec {
+				child.selected = addState(child.selected, j)
+			} else if index, err := strconv.Atoi(spec); err == nil && key == index {
+				child.selected = addState(child.selected, j)
+			}
+		}
+	}
+
+	return child
+}
+
+// skip reads the next value without decoding it.
+func (s *jsonStream) skip() error {
+	return s.skipFrom(0)
+}
+
+// skipRest reads the rest of an object or array, whose opening delimiter has already been read, without decoding it.
+func (s *jsonStream) skipRest() error {
+	return s.skipFrom(1)
+}
+
+func (s *jsonStream) skipFrom(depth int) error {
+	for {
+		token, err := s.decoder.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// walk evaluates the query on the next value of the stream. The parent elements carry only the keys of the values,
+// so that results have their full paths. Scalars are decoded if any part applies to them, objects and arrays
+// only if they are results or if they have to be checked by filters, which depend on their content.
+func (s *jsonStream) walk(parent *Element, key interface{}, states streamStates) error {
+	states, isResult := s.resolve(states)
+	if len(states.apply) == 0 && len(states.selected) == 0 {
+		return s.skip()
+	} else if err := s.eval.visit(NewElement(nil, parent, key)); err != nil {
+		return err
+	}
+
+	token, err := s.decoder.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	// Objects and arrays are walked into, unless they are results or their filters depend on their content.
+	decode := isResult || (token != json.Delim('{') && token != json.Delim('['))
+	if !decode {
+		if resolved, ok := s.resolveContainer(states); ok {
+			states, decode = resolved, containsState(resolved.apply, len(s.parts))
+		} else {
+			decode = true
+		}
+	}
+
+	if decode {
+		value, err := s.decoder.decodeToken(token)
+		if err != nil {
+			return err
+		}
+
+		elem := NewElement(value, parent, key)
+		results := map[string]Element{}
+		for _, j := range states.apply {
+			if err := s.addQueryResults(results, elem, s.parts[j:]); err != nil {
+				return err
+			}
+		}
+		for _, i := range states.selected {
+			if elem.MatchesFilters(s.parts[i].Filters) {
+				if err := s.addQueryResults(results, elem, s.parts[i+1:]); err != nil {
+					return err
+				}
+			}
+		}
+		return s.emitResults(results)
+	} else if len(states.apply) == 0 {
+		return s.skipRest()
+	}
+
+	elem := NewElement(nil, parent, key)
+
+	switch token {
+	case json.Delim('{'):
+		for s.decoder.decoder.More() {
+			keyToken, err := s.decoder.decoder.Token()
+			if err != nil {
+				return err
+			}
+
+			childKey, ok := keyToken.(string)
+			if !ok {
+				return fmt.Errorf("unexpected JSON object key: %v", keyToken)
+			}
+
+			if err := s.walk(&elem, childKey, s.childStates(states, childKey)); err != nil {
+				return err
+			}
+		}
+
+	case json.Delim('['):
+		for index := 0; s.decoder.decoder.More(); index++ {
+			if err := s.walk(&elem, index, s.childStates(states, index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Closing brace or bracket.
+	_, err = s.decoder.decoder.Token()
+	return err
+}
+
+// addQueryResults evaluates the query on a decoded element and adds its results.
+func (s *jsonStream) addQueryResults(results map[string]Element, elem Element, parts []parser.QueryPart) error {
+	elemResults, err := elem.query(s.eval, parts)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range elemResults {
+		results[k] = v
+	}
+	return nil
+}
+
+// emitResults applies the functions to the results and emits them in document order.
+func (s *jsonStream) emitResults(results map[string]Element) error {
+	for _, call := range s.calls {
+		var err error
+		var exists bool
+		if results, exists, err = applyFunction(results, call); !exists {
+			return fmt.Errorf("unknown operator or function: %s", call.Name)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range Sorted(results) {
+		if s.emitted != nil {
+			if s.emitted[e.GetFullPath()] {
+				continue
+			}
+			s.emitted[e.GetFullPath()] = true
+		}
+
+		if err := s.eval.addResults(1); err != nil {
+			return err
+		} else if err := s.emit(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunJsonStream runs the query on a JSON document without decoding all of it. Only the results, scalars
+// checked by filters and objects and arrays checked by filters which depend on their content (such as
+// predicates of interface{} values) are decoded, so huge documents can be queried
+// as long as their results fit in memory. Results are passed to the emit function as soon as they are found,
+// in document order. Their parents carry only keys, not values, and their positions are unknown.
+// Queries with parent navigation or operators cannot be evaluated this way, so the whole document
+// is decoded for them, as in RunJson. So is the document of JSONPath queries, whose node lists are emitted
+// in the order of the selectors (see RunNodes). If the emit function returns an error, the evaluation stops and the error is returned.
+func (r *Runner) RunJsonStream(query string, reader io.Reader, emit func(Element) error) error {
+	return r.RunJsonStreamContext(context.Background(), query, reader, emit)
+}
+
+// RunJsonStreamContext runs the query like RunJsonStream, but the evaluation stops with an error
+// when the context is cancelled or when a limit is exceeded (see LimitError).
+func (r *Runner) RunJsonStreamContext(ctx context.Context, query string, reader io.Reader, emit func(Element) error) error {
+	stages, err := r.parseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	if r.options.Dialect == parser.JSONPathDialect {
+		doc, err := r.DecodeJson(reader)
+		if err != nil {
+			return err
+		}
+
+		nodes, err := RunJSONPathContext(ctx, stages[0].Parts, NewElementRoot(doc), r.options.Limits)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range nodes {
+			if err := emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	eval := newEvaluation(ctx, r.options.Limits)
+
+	if !isStreamable(stages) {
+		r.logf("Query cannot be evaluated on a stream, decoding the whole document\n")
+
+		doc, err := r.DecodeJson(reader)
+		if err != nil {
+			return err
+		}
+
+		results, err := runPipeline(eval, stages, NewElementRoot(doc))
+		if err != nil {
+			return err
+		}
+
+		for _, e := range Sorted(results) {
+			if err := emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	s := &jsonStream{decoder: &jsonDecoder{decoder: decoder, exact: !r.options.PlainJSON}, parts: stages[0].Parts, emit: emit, eval: eval}
+
+	for _, stage := range stages[1:] {
+		s.calls = append(s.calls, stage.Call)
+	}
+
+	// Only multiple recursive parts can select the same element repeatedly.
+	recursive := 0
+	for _, part := range s.parts {
+		if part.IsRecursive() {
+			recursive++
+		}
+	}
+	if recursive > 1 {
+		s.emitted = map[string]bool{}
+	}
+
+	if err := s.walk(nil, nil, streamStates{apply: []int{0}}); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after top-level JSON value")
+	}
+
+	return nil
+}
+
+func (r *Runner) RunJsonStreamFile(query string, jsonPath string, emit func(Element) error) error {
+	f, err := os.Open(jsonPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.RunJsonStream(query, f, emit)
+}
+
+func RunJsonStream(query string, r io.Reader, emit func(Element) error) error {
+	return defaultRunner.RunJsonStream(query, r, emit)
+}
+
+func RunJsonStreamFile(query string, jsonPath string, emit func(Element) error) error {
+	return defaultRunner.RunJsonStreamFile(query, jsonPath, emit)
+}
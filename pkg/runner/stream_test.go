@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Queries whose streamed results are compared with the results of the same query on the decoded document.
+// Objects are decoded by the exact runner, so that their keys are in document order as when streaming.
+var testTabJSONStreamOrder = []string{
+	``,
+	`**`,
+	`**.name`,
+	`**.**.debt`,
+	`**=0`,
+	`**!=0`,
+	`*!~Doe.name`,
+	`**@lt(1000)`,
+	`*.*`,
+	`3`,
+	`**.name | lower()`,
+	`**!@ip.name`,
+	`*!=x.*`,
+	`**@lt(1000)=0`,
+	`**=0.**`,
+}
+
+func runJsonStreamString(query string, source string) (map[string]Element, error) {
+	results := map[string]Element{}
+	err := RunJsonStream(query, strings.NewReader(source), func(e Element) error {
+		results[e.GetFullPath()] = e
+		return nil
+	})
+	return results, err
+}
+
+func TestRunJsonStream(t *testing.T) {
+	for _, tab := range []testTab{
+		testTabJSONChildlessRoot, testTabJSONSingleChildRoot, testTabJSONEquality, testTabJSONEqualityInverted,
+		testTabJSONRegex, testTabJSONRegexInverted, testTabJSONGroupBy, testTabJSONFunctions,
+		testTabJSONDateTime, testTabJSONSemver, testTabJSONIP,
+	} {
+		runTests(t, tab, false, runJsonStreamString)
+	}
+}
+
+func TestJsonStreamOrder(t *testing.T) {
+	for index, query := range testTabJSONStreamOrder {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			results, err := RunJsonString(query, complexJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []string{}
+			for _, e := range Sorted(results) {
+				expected = append(expected, e.GetFullPath())
+			}
+
+			streamed := []string{}
+			err = RunJsonStream(query, strings.NewReader(complexJSON), func(e Element) error {
+				streamed = append(streamed, e.GetFullPath())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(streamed, expected) {
+				t.Errorf("Unexpected streamed results of query `%s`: %v instead of %v", query, streamed, expected)
+			}
+		})
+	}
+}
+
+// errStop stops streaming after the first result.
+var errStop = errors.New("stop")
+
+// Queries with filters on all elements, which do not depend on the content of objects and arrays.
+var testTabJSONStreamFilters = []string{
+	`**=0`,
+	`**!=x.name`,
+	`**@lt(1)`,
+	`**!@ip.*=0`,
+	`*.*!~x`,
+}
+
+func TestJsonStreamFilters(t *testing.T) {
+	// The document is invalid after the first result, so the query fails if it is decoded entirely before evaluation.
+	const source = `[{"name": "a", "debt": 0}, {"name": "b", "debt": 1}, {"name": "c", "debt": 0, "x": ]`
+
+	for index, query := range testTabJSONStreamFilters {
+		t.Run(strconv.Itoa(index), func(t *testing.T) {
+			err := RunJsonStream(query, strings.NewReader(source), func(Element) error {
+				return errStop
+			})
+			if err != errStop {
+				t.Errorf("Query `%s` returned %v instead of the first result", query, err)
+			}
+		})
+	}
+}
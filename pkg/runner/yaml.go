@@ -0,0 +1,575 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	yamlMergeTag = "!!merge"
+	yamlStrTag   = "!!str"
+)
+
+// DecodeYaml decodes a YAML stream, keeping the node trees of its documents.
+// A stream of multiple documents (separated by `---`) is decoded as an array with an item for each document,
+// so is a stream of a single document if the runner has the YAMLStreams option.
+// The returned value is a *Document, which can be queried like the decoded value (see Document.Root)
+// and which knows the positions of its values.
+func (r *Runner) DecodeYaml(reader io.Reader) (interface{}, error) {
+	source, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeYamlSource(source, r.options.YAMLStreams)
+}
+
+func DecodeYaml(r io.Reader) (interface{}, error) {
+	return defaultRunner.DecodeYaml(r)
+}
+
+// decodeYamlSource decodes the YAML stream in the source into a document. If stream is false,
+// a stream of a single document is decoded as the document.
+func decodeYamlSource(source []byte, stream bool) (*Document, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	nodes := []*yaml.Node{}
+	roots := []interface{}{}
+	for {
+		node := &yaml.Node{}
+		if err := decoder.Decode(node); err == io.EOF && len(nodes) > 0 {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		root, err := decodeYamlRoot(node)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+		roots = append(roots, root)
+	}
+
+	doc := newDocument(source)
+	if len(nodes) == 1 && !stream {
+		doc.Root = roots[0]
+		doc.Node = nodes[0]
+	} else {
+		// Document nodes are transparent, so the items of the sequence behave as the content of the documents.
+		doc.Root = roots
+		doc.Node = &yaml.Node{Kind: yaml.SequenceNode, Content: nodes}
+		doc.stream = true
+	}
+	doc.yamlMappings = indexYamlMappings(doc.Node, map[*yaml.Node]*yamlMapping{})
+	return doc, nil
+}
+
+// yaml11Bools are the plain scalars, which are booleans in YAML 1.1, but strings in YAML 1.2.
+var yaml11Bools = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+}
+
+// yaml11Bool resolves a plain scalar as in YAML 1.1, so that keys such as `on` (in GitHub workflows)
+// and values such as `enabled: yes` are booleans, as they have always been.
+func yaml11Bool(node *yaml.Node) (bool, bool) {
+	if node.Kind != yaml.ScalarNode || node.Style != 0 || node.Tag != yamlStrTag {
+		return false, false
+	}
+
+	value, ok := yaml11Bools[node.Value]
+	return value, ok
+}
+
+// decodeYamlRoot decodes the value of the node. Scalars which are booleans in YAML 1.1 are decoded as booleans.
+func decodeYamlRoot(node *yaml.Node) (interface{}, error) {
+	type scalar struct {
+		node  *yaml.Node
+		value string
+	}
+
+	// The scalars are tagged as booleans while the node is decoded, then they are restored,
+	// so that they are encoded as they were written.
+	bools := []scalar{}
+	var tagBools func(node *yaml.Node)
+	tagBools = func(node *yaml.Node) {
+		if value, ok := yaml11Bool(node); ok {
+			bools = append(bools, scalar{node, node.Value})
+			node.Tag, node.Value = "!!bool", strconv.FormatBool(value)
+		}
+		for _, child := range node.Content {
+			tagBools(child)
+		}
+	}
+	tagBools(node)
+
+	defer func() {
+		for _, b := range bools {
+			b.node.Tag, b.node.Value = yamlStrTag, b.value
+		}
+	}()
+
+	var root interface{}
+	err := node.Decode(&root)
+	return root, err
+}
+
+// decodeRoot decodes the root value of the document from its node tree again, after the node tree has been modified.
+// Values of aliases are copies of the anchored values in the root, so they are updated only by decoding it again.
+// Keys of the mappings are indexed again as well.
+func (d *Document) decodeRoot() error {
+	d.yamlMappings = indexYamlMappings(d.Node, map[*yaml.Node]*yamlMapping{})
+
+	if !d.stream {
+		root, err := decodeYamlRoot(d.Node)
+		d.Root = root
+		return err
+	}
+
+	roots := []interface{}{}
+	for _, node := range d.Node.Content {
+		root, err := decodeYamlRoot(node)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+	d.Root = roots
+	return nil
+}
+
+// yamlIndent guesses the indentation of the document from the position of the first nested mapping.
+func yamlIndent(node *yaml.Node) int {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return yamlIndent(node.Content[0])
+	} else if node.Kind != yaml.MappingNode {
+		return 0
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind == yaml.MappingNode && value.Style&yaml.FlowStyle == 0 && len(value.Content) > 0 && value.Content[0].Column > key.Column {
+			return value.Content[0].Column - key.Column
+		}
+		if indent := yamlIndent(value); indent > 0 {
+			return indent
+		}
+	}
+
+	return 0
+}
+
+func (r *Runner) EncodeYaml(w io.Writer, root interface{}) error {
+	encoder := yaml.NewEncoder(w)
+
+	if doc, ok := root.(*Document); ok && doc.Node != nil {
+		documents := []*yaml.Node{doc.Node}
+		if doc.stream {
+			documents = doc.Node.Content
+		} else {
+			root = doc.Node
+		}
+
+		for _, node := range documents {
+			if indent := yamlIndent(node); indent > 0 {
+				encoder.SetIndent(indent)
+				break
+			}
+		}
+
+		// The encoder writes merge keys with their explicit tag (`!!merge <<`), unless the tag is removed.
+		mergeKeys := yamlMergeKeys(doc.Node, []*yaml.Node{})
+		for _, key := range mergeKeys {
+			key.Tag = ""
+		}
+		defer func() {
+			for _, key := range mergeKeys {
+				key.Tag = yamlMergeTag
+			}
+		}()
+	} else {
+		if doc, ok := root.(*Document); ok {
+			root = doc.Root
+		}
+		encoder.SetIndent(2)
+	}
+
+	if r.options.Indent > 0 {
+		encoder.SetIndent(r.options.Indent)
+	}
+
+	// Each document of a stream is encoded separately, so that they are separated by `---` again.
+	if doc, ok := root.(*Document); ok && doc.stream {
+		for _, node := range doc.Node.Content {
+			if err := encoder.Encode(node); err != nil {
+				return err
+			}
+		}
+	} else if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func EncodeYaml(w io.Writer, root interface{}) error {
+	return defaultRunner.EncodeYaml(w, root)
+}
+
+func yamlMergeKeys(node *yaml.Node, keys []*yaml.Node) []*yaml.Node {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Tag == yamlMergeTag {
+				keys = append(keys, node.Content[i])
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		keys = yamlMergeKeys(child, keys)
+	}
+
+	return keys
+}
+
+// resolveYamlNode skips document and alias nodes, which are transparent in decoded values.
+func resolveYamlNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+			node = node.Content[0]
+		} else if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		} else {
+			break
+		}
+	}
+
+	return node
+}
+
+func yamlKey(node *yaml.Node) interface{} {
+	if value, ok := yaml11Bool(node); ok {
+		return value
+	}
+
+	if node.Kind == yaml.ScalarNode && node.Tag == yamlStrTag {
+		return node.Value
+	}
+
+	var key interface{}
+	if err := node.Decode(&key); err != nil {
+		return nil
+	}
+	return key
+}
+
+// yamlMappingIndex returns the index of the value node of the key within the mapping content,
+// or -1 if the mapping does not contain the key directly (it may still contain it through a merge key).
+func yamlMappingIndex(mapping *yaml.Node, key interface{}) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Tag != yamlMergeTag && yamlKey(mapping.Content[i]) == key {
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// yamlChildNode finds the node of the child with the specified key. It returns nil if there is no such node.
+func yamlChildNode(node *yaml.Node, key interface{}) *yaml.Node {
+	node = resolveYamlNode(node)
+	if node == nil {
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		_, value := yamlMappingEntry(node, key)
+		return value
+
+	case yaml.SequenceNode:
+		if index, ok := key.(int); ok && index >= 0 && index < len(node.Content) {
+			return node.Content[index]
+		}
+	}
+
+	return nil
+}
+
+// yamlMappingEntry finds the key and value nodes of the key within the mapping,
+// including keys merged from other mappings (`<<: *anchor`). It returns nil nodes if there is no such key.
+func yamlMappingEntry(mapping *yaml.Node, key interface{}) (*yaml.Node, *yaml.Node) {
+	if i := yamlMappingIndex(mapping, key); i >= 0 {
+		return mapping.Content[i-1], mapping.Content[i]
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Tag == yamlMergeTag {
+			sources := []*yaml.Node{mapping.Content[i+1]}
+			if merged := resolveYamlNode(mapping.Content[i+1]); merged.Kind == yaml.SequenceNode {
+				sources = merged.Content
+			}
+
+			for _, source := range sources {
+				if source = resolveYamlNode(source); source != nil && source.Kind == yaml.MappingNode {
+					if keyNode, valueNode := yamlMappingEntry(source, key); keyNode != nil {
+						return keyNode, valueNode
+					}
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// yamlMapping indexes the keys of a mapping node, so that its children are found without scanning its content.
+type yamlMapping struct {
+	// indexes are the indexes of the value nodes within the mapping content (see yamlMappingIndex).
+	indexes map[interface{}]int
+	// entries are the key and value nodes of the keys, including the merged keys (see yamlMappingEntry).
+	entries map[interface{}][2]*yaml.Node
+}
+
+// isIndexableKey reports whether the key can be used as a key of the indexes.
+func isIndexableKey(key interface{}) bool {
+	return key == nil || reflect.TypeOf(key).Comparable()
+}
+
+// indexYamlMappings indexes the keys of all mapping nodes in the node tree.
+// Keys which cannot be indexed are left out, so they are found by scanning the content.
+func indexYamlMappings(node *yaml.Node, mappings map[*yaml.Node]*yamlMapping) map[*yaml.Node]*yamlMapping {
+	if node == nil || node.Kind == yaml.AliasNode {
+		// Anchored values are indexed where they are defined.
+		return mappings
+	}
+
+	if node.Kind == yaml.MappingNode {
+		indexYamlMapping(node, mappings)
+	}
+	for _, child := range node.Content {
+		indexYamlMappings(child, mappings)
+	}
+	return mappings
+}
+
+// indexYamlMapping indexes the keys of the mapping node, after the mappings merged into it.
+func indexYamlMapping(mapping *yaml.Node, mappings map[*yaml.Node]*yamlMapping) *yamlMapping {
+	if m, ok := mappings[mapping]; ok {
+		return m
+	}
+
+	m := &yamlMapping{indexes: map[interface{}]int{}, entries: map[interface{}][2]*yaml.Node{}}
+	mappings[mapping] = m
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if key := yamlKey(mapping.Content[i]); mapping.Content[i].Tag != yamlMergeTag && isIndexableKey(key) {
+			if _, exists := m.indexes[key]; !exists {
+				m.indexes[key] = i + 1
+				m.entries[key] = [2]*yaml.Node{mapping.Content[i], mapping.Content[i+1]}
+			}
+		}
+	}
+
+	// Keys of the mapping override the merged keys, earlier merged mappings override the later ones.
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Tag != yamlMergeTag {
+			continue
+		}
+
+		sources := []*yaml.Node{mapping.Content[i+1]}
+		if merged := resolveYamlNode(mapping.Content[i+1]); merged.Kind == yaml.SequenceNode {
+			sources = merged.Content
+		}
+
+		for _, source := range sources {
+			if source = resolveYamlNode(source); source != nil && source.Kind == yaml.MappingNode {
+				for key, entry := range indexYamlMapping(source, mappings).entries {
+					if _, exists := m.entries[key]; !exists {
+						m.entries[key] = entry
+					}
+				}
+			}
+		}
+	}
+
+	return m
+}
+
+// yamlMappingIndex is the same as the yamlMappingIndex function, but it uses the index of the document if it has one.
+func (d *Document) yamlMappingIndex(mapping *yaml.Node, key interface{}) int {
+	if m := d.yamlMapping(mapping, key); m != nil {
+		if i, ok := m.indexes[key]; ok {
+			return i
+		}
+		return -1
+	}
+
+	return yamlMappingIndex(mapping, key)
+}
+
+// yamlMappingEntry is the same as the yamlMappingEntry function, but it uses the index of the document if it has one.
+func (d *Document) yamlMappingEntry(mapping *yaml.Node, key interface{}) (*yaml.Node, *yaml.Node) {
+	if m := d.yamlMapping(mapping, key); m != nil {
+		entry := m.entries[key]
+		return entry[0], entry[1]
+	}
+
+	return yamlMappingEntry(mapping, key)
+}
+
+// yamlChildNode is the same as the yamlChildNode function, but it uses the index of the document if it has one.
+func (d *Document) yamlChildNode(node *yaml.Node, key interface{}) *yaml.Node {
+	if mapping := resolveYamlNode(node); mapping != nil && mapping.Kind == yaml.MappingNode {
+		_, value := d.yamlMappingEntry(mapping, key)
+		return value
+	}
+
+	return yamlChildNode(node, key)
+}
+
+// yamlMapping returns the index of the mapping node, or nil if the key cannot be looked up in the index.
+func (d *Document) yamlMapping(mapping *yaml.Node, key interface{}) *yamlMapping {
+	if d == nil || !isIndexableKey(key) {
+		return nil
+	}
+	return d.yamlMappings[mapping]
+}
+
+// yamlNodeAt finds the node at the key path. It returns nil if there is no such node.
+func yamlNodeAt(node *yaml.Node, path []interface{}) *yaml.Node {
+	for _, key := range path {
+		if node = yamlChildNode(node, key); node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// checkYamlPath checks that the value at the key path can be modified without modifying other values.
+// Values reached through an alias or a merge key are shared with the anchored value, so they cannot be modified.
+// The value itself may be an alias or merged, because it is replaced without modifying the anchored value.
+func checkYamlPath(doc *yaml.Node, path []interface{}) error {
+	node := doc
+	for i := 0; i+1 < len(path); i++ {
+		parent := resolveYamlNode(node)
+		if parent == nil {
+			return nil
+		} else if parent.Kind == yaml.MappingNode && yamlMappingIndex(parent, path[i]) < 0 {
+			return fmt.Errorf("unable to modify %#v, because %#v is merged from another YAML mapping", path, path[:i+1])
+		}
+
+		if node = yamlChildNode(parent, path[i]); node == nil {
+			return nil
+		} else if node.Kind == yaml.AliasNode {
+			return fmt.Errorf("unable to modify %#v through YAML alias *%s (modify the anchored value instead)", path, node.Value)
+		}
+	}
+
+	return nil
+}
+
+// replaceYamlNode replaces the content of the node with the encoded value, keeping the comments
+// and, if the new value is a scalar of the same type, also the scalar style.
+func replaceYamlNode(node *yaml.Node, value interface{}) error {
+	encoded := &yaml.Node{}
+	if err := encoded.Encode(value); err != nil {
+		return err
+	}
+
+	// Strings which are booleans in YAML 1.1 stay quoted, so that they are not decoded as booleans.
+	if node.Kind == yaml.ScalarNode && encoded.Kind == yaml.ScalarNode && node.ShortTag() == encoded.ShortTag() {
+		if _, isBool := yaml11Bool(&yaml.Node{Kind: yaml.ScalarNode, Tag: encoded.ShortTag(), Value: encoded.Value}); !isBool || node.Style != 0 {
+			encoded.Style = node.Style
+		}
+	}
+
+	encoded.HeadComment = node.HeadComment
+	encoded.LineComment = node.LineComment
+	encoded.FootComment = node.FootComment
+	*node = *encoded
+	return nil
+}
+
+// setYamlNode stores the value at the key path in the node tree.
+func setYamlNode(doc *yaml.Node, path []interface{}, value interface{}) error {
+	if len(path) == 0 {
+		return replaceYamlNode(resolveDocumentContent(doc), value)
+	}
+
+	parent := resolveYamlNode(yamlNodeAt(doc, path[:len(path)-1]))
+	if parent == nil {
+		return fmt.Errorf("unable to find YAML node at %#v", path[:len(path)-1])
+	}
+
+	key := path[len(path)-1]
+	if parent.Kind != yaml.MappingNode {
+		if node := yamlChildNode(parent, key); node != nil {
+			// Items of YAML streams are document nodes.
+			return replaceYamlNode(resolveDocumentContent(node), value)
+		}
+		return fmt.Errorf("unable to set key %#v of YAML node", key)
+	} else if i := yamlMappingIndex(parent, key); i >= 0 {
+		return replaceYamlNode(parent.Content[i], value)
+	}
+
+	// The key has been merged from another mapping, so it is added to override the merged value.
+	keyNode, valueNode := &yaml.Node{}, &yaml.Node{}
+	if err := keyNode.Encode(key); err != nil {
+		return err
+	} else if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	parent.Content = append(parent.Content, keyNode, valueNode)
+	return nil
+}
+
+// deleteYamlNode removes the node at the key path from the node tree.
+func deleteYamlNode(doc *yaml.Node, path []interface{}) error {
+	if len(path) == 0 {
+		return replaceYamlNode(resolveDocumentContent(doc), nil)
+	}
+
+	parent := resolveYamlNode(yamlNodeAt(doc, path[:len(path)-1]))
+	if parent == nil {
+		return fmt.Errorf("unable to find YAML node at %#v", path[:len(path)-1])
+	}
+
+	key := path[len(path)-1]
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if i := yamlMappingIndex(parent, key); i >= 0 {
+			parent.Content = append(parent.Content[:i-1], parent.Content[i+1:]...)
+			return nil
+		}
+		return fmt.Errorf("unable to delete key %#v merged from another YAML mapping", key)
+
+	case yaml.SequenceNode:
+		if index, ok := key.(int); ok && index >= 0 && index < len(parent.Content) {
+			parent.Content = append(parent.Content[:index], parent.Content[index+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unable to delete key %#v of YAML node", key)
+}
+
+// resolveDocumentContent returns the root content node of the document, creating it if the document is empty.
+func resolveDocumentContent(doc *yaml.Node) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode {
+		return doc
+	}
+
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}}
+	}
+	return doc.Content[0]
+}
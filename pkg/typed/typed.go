@@ -0,0 +1,220 @@
+// Package typed adapts Go functions with typed parameters to filters and functions, whose arguments are strings.
+// The first parameter of an adapted function receives the value, the others receive the arguments,
+// which are converted to the types of the parameters when a query is compiled.
+package typed
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpType   = reflect.TypeOf((*regexp.Regexp)(nil))
+	numberType   = reflect.TypeOf(json.Number(""))
+)
+
+// Func is a Go function with typed parameters.
+type Func struct {
+	fn reflect.Value
+}
+
+// New checks that fn is a function with at least one parameter (the value) and with parameters of supported types:
+// strings, booleans, numbers, time.Duration, *regexp.Regexp and interface{} (which receives strings).
+func New(fn interface{}) (Func, error) {
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func {
+		return Func{}, fmt.Errorf("expected a function, got %T", fn)
+	}
+
+	fnType := fnValue.Type()
+	if fnType.NumIn() == 0 {
+		return Func{}, fmt.Errorf("function %s has no parameter for the value", fnType)
+	}
+	for i := 1; i < fnType.NumIn(); i++ {
+		paramType := fnType.In(i)
+		if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+			paramType = paramType.Elem()
+		}
+		if !isSupported(paramType) {
+			return Func{}, fmt.Errorf("unsupported type of parameter %d of function %s: %s", i+1, fnType, paramType)
+		}
+	}
+
+	return Func{fn: fnValue}, nil
+}
+
+// Type returns the type of the function.
+func (f Func) Type() reflect.Type {
+	return f.fn.Type()
+}
+
+// ValueType returns the type of the value parameter.
+func (f Func) ValueType() reflect.Type {
+	return f.fn.Type().In(0)
+}
+
+func isSupported(t reflect.Type) bool {
+	if t == durationType || t == regexpType || t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Bind converts the (already unquoted) arguments to the types of the parameters. The returned function calls
+// the function with the value and the arguments. Its second return value is false if the value
+// cannot be converted to the type of the value parameter.
+func (f Func) Bind(args []string) (func(value interface{}) ([]reflect.Value, bool), error) {
+	fnType := f.fn.Type()
+	params := fnType.NumIn() - 1
+
+	if fnType.IsVariadic() {
+		if len(args) < params-1 {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", params-1, len(args))
+		}
+	} else if len(args) != params {
+		return nil, fmt.Errorf("expected %d arguments, got %d", params, len(args))
+	}
+
+	in := make([]reflect.Value, 1+len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if fnType.IsVariadic() && 1+i >= fnType.NumIn()-1 {
+			paramType = fnType.In(fnType.NumIn() - 1).Elem()
+		} else {
+			paramType = fnType.In(1 + i)
+		}
+
+		converted, err := parseArg(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		in[1+i] = converted
+	}
+
+	return func(value interface{}) ([]reflect.Value, bool) {
+		converted, ok := ConvertValue(value, fnType.In(0))
+		if !ok {
+			return nil, false
+		}
+
+		// The arguments are shared by concurrent calls, so each call gets its own copy of the slice.
+		callIn := append([]reflect.Value{converted}, in[1:]...)
+		return f.fn.Call(callIn), true
+	}, nil
+}
+
+// parseArg converts the argument to the type.
+func parseArg(arg string, t reflect.Type) (reflect.Value, error) {
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(arg)
+		return reflect.ValueOf(d), err
+
+	case t == regexpType:
+		regex, err := regexp.Compile(arg)
+		return reflect.ValueOf(regex), err
+
+	case t.Kind() == reflect.Interface:
+		return reflect.ValueOf(&arg).Elem().Convert(t), nil
+	}
+
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(arg)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return value, fmt.Errorf("invalid boolean: %q", arg)
+		}
+		value.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(arg, 10, t.Bits())
+		if err != nil {
+			return value, fmt.Errorf("invalid integer: %q", arg)
+		}
+		value.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(arg, 10, t.Bits())
+		if err != nil {
+			return value, fmt.Errorf("invalid unsigned integer: %q", arg)
+		}
+		value.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(arg, t.Bits())
+		if err != nil {
+			return value, fmt.Errorf("invalid number: %q", arg)
+		}
+		value.SetFloat(f)
+	}
+
+	return value, nil
+}
+
+// ConvertValue converts a queried value to the type. Numbers of any type (including json.Number)
+// are converted to numeric types, if they are representable by them.
+func ConvertValue(value interface{}, t reflect.Type) (reflect.Value, bool) {
+	if value == nil {
+		if t.Kind() == reflect.Interface {
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(t) {
+		converted := reflect.New(t).Elem()
+		converted.Set(v)
+		return converted, true
+	} else if v.Kind() == reflect.String && t.Kind() == reflect.String && v.Type() != numberType {
+		return v.Convert(t), true
+	}
+
+	// Numbers are converted using their decimal representation, so that precision is not lost unnoticed.
+	var literal string
+	switch n := value.(type) {
+	case json.Number:
+		literal = string(n)
+
+	case float64:
+		literal = strconv.FormatFloat(n, 'f', -1, 64)
+
+	case float32:
+		literal = strconv.FormatFloat(float64(n), 'f', -1, 32)
+
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		literal = fmt.Sprintf("%d", n)
+
+	default:
+		return reflect.Value{}, false
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		converted, err := parseArg(literal, t)
+		return converted, err == nil
+
+	default:
+		return reflect.Value{}, false
+	}
+}
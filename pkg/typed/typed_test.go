@@ -0,0 +1,139 @@
+package typed
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTabNewErrors = []interface{}{
+	nil,
+	"upper",
+	func() bool { return true },
+	func(string, []string) bool { return true },
+	func(string, map[string]int) bool { return true },
+	func(string, ...*int) bool { return true },
+}
+
+func TestNew(t *testing.T) {
+	for _, fn := range testTabNewErrors {
+		if _, err := New(fn); err == nil {
+			t.Errorf("Function %T was expected to be rejected", fn)
+		}
+	}
+
+	f, err := New(func(s string, n int) bool { return len(s) == n })
+	if err != nil {
+		t.Fatal(err)
+	} else if f.ValueType() != reflect.TypeOf("") || f.Type().NumIn() != 2 {
+		t.Errorf("Unexpected type of function: %s", f.Type())
+	}
+}
+
+var testTabBind = []struct {
+	fn       interface{}
+	args     []string
+	value    interface{}
+	expected interface{}
+}{
+	{func(s string, prefix string) bool { return strings.HasPrefix(s, prefix) }, []string{"ab"}, "abc", true},
+	{func(s string, b bool) bool { return b }, []string{"true"}, "x", true},
+	{func(n int64, i int8) int64 { return n + int64(i) }, []string{"-5"}, 10.0, int64(5)},
+	{func(n uint16, u uint) uint16 { return n * uint16(u) }, []string{"3"}, json.Number("7"), uint16(21)},
+	{func(n float32, f float64) float64 { return float64(n) * f }, []string{"1.5"}, 2, 3.0},
+	{func(d time.Duration, offset time.Duration) time.Duration { return d + offset }, []string{"1h30m"}, time.Minute, 91 * time.Minute},
+	{func(s string, re *regexp.Regexp) bool { return re.MatchString(s) }, []string{"^a+$"}, "aaa", true},
+	{func(v interface{}, arg interface{}) interface{} { return arg }, []string{"x"}, nil, "x"},
+	{func(s string, parts ...string) int { return len(parts) }, []string{}, "", 0},
+	{func(s string, parts ...string) int { return len(parts) }, []string{"a", "b", "c"}, "", 3},
+	{func(s string, first int, rest ...int) int { return first + len(rest) }, []string{"1", "2"}, "", 2},
+}
+
+var testTabBindErrors = []struct {
+	fn   interface{}
+	args []string
+}{
+	{func(s string) bool { return true }, []string{"a"}},
+	{func(s string, a string) bool { return true }, []string{}},
+	{func(s string, a int, rest ...int) bool { return true }, []string{}},
+	{func(s string, b bool) bool { return b }, []string{"maybe"}},
+	{func(s string, i int8) bool { return true }, []string{"200"}},
+	{func(s string, u uint) bool { return true }, []string{"-1"}},
+	{func(s string, f float64) bool { return true }, []string{"x"}},
+	{func(s string, d time.Duration) bool { return true }, []string{"7"}},
+	{func(s string, re *regexp.Regexp) bool { return true }, []string{"("}},
+}
+
+func TestBind(t *testing.T) {
+	for _, entry := range testTabBind {
+		f, err := New(entry.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		call, err := f.Bind(entry.args)
+		if err != nil {
+			t.Errorf("Arguments %q of %s returned an error: %v", entry.args, f.Type(), err)
+			continue
+		}
+
+		if out, ok := call(entry.value); !ok {
+			t.Errorf("Value %#v was not converted for %s", entry.value, f.Type())
+		} else if result := out[0].Interface(); result != entry.expected {
+			t.Errorf("Unexpected result of %s: %#v instead of %#v", f.Type(), result, entry.expected)
+		}
+	}
+
+	for _, entry := range testTabBindErrors {
+		f, err := New(entry.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Bind(entry.args); err == nil {
+			t.Errorf("Arguments %q of %s were expected to be rejected", entry.args, f.Type())
+		}
+	}
+}
+
+type label string
+
+var testTabConvertValue = []struct {
+	value    interface{}
+	t        reflect.Type
+	expected interface{}
+	ok       bool
+}{
+	{"a", reflect.TypeOf(""), "a", true},
+	{"a", reflect.TypeOf(label("")), label("a"), true},
+	{label("a"), reflect.TypeOf(""), "a", true},
+	{1.5, reflect.TypeOf(0.0), 1.5, true},
+	{1.0, reflect.TypeOf(0), 1, true},
+	{1.5, reflect.TypeOf(0), nil, false},
+	{300, reflect.TypeOf(uint8(0)), nil, false},
+	{-1, reflect.TypeOf(uint(0)), nil, false},
+	{json.Number("9007199254740993"), reflect.TypeOf(int64(0)), int64(9007199254740993), true},
+	{float32(0.5), reflect.TypeOf(0.0), 0.5, true},
+	// Numbers are not strings, even though json.Number is a string type.
+	{json.Number("1"), reflect.TypeOf(""), nil, false},
+	{1, reflect.TypeOf(""), nil, false},
+	{"1", reflect.TypeOf(0), nil, false},
+	{true, reflect.TypeOf(false), true, true},
+	{nil, reflect.TypeOf((*interface{})(nil)).Elem(), nil, true},
+	{nil, reflect.TypeOf(""), nil, false},
+	{[]interface{}{}, reflect.TypeOf(0), nil, false},
+}
+
+func TestConvertValue(t *testing.T) {
+	for _, entry := range testTabConvertValue {
+		converted, ok := ConvertValue(entry.value, entry.t)
+		if ok != entry.ok {
+			t.Errorf("Value %#v was converted to %s: %t", entry.value, entry.t, ok)
+		} else if ok && converted.Interface() != entry.expected {
+			t.Errorf("Value %#v was converted to %#v instead of %#v", entry.value, converted.Interface(), entry.expected)
+		}
+	}
+}
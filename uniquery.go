@@ -0,0 +1,152 @@
+// Package uniquery is the library interface of UniQuery. Queries are compiled once
+// and can then be evaluated on any number of documents.
+//
+//	query, err := uniquery.Compile(`*.debt=0..name`)
+//	if err != nil {
+//		return err
+//	}
+//	results, err := query.EvalJSON(file)
+package uniquery
+
+import (
+	"context"
+	"io"
+
+	"github.com/natiiix/uniquery/pkg/parser"
+	"github.com/natiiix/uniquery/pkg/runner"
+)
+
+// Element is a single result of a query.
+type Element = runner.Element
+
+// Query is a compiled query. It is immutable, so it can be evaluated by multiple goroutines at once.
+type Query struct {
+	source string
+	stages []parser.Stage
+	limits runner.Limits
+	// jsonPath is true for JSONPath queries, whose node lists are returned by EvalNodes.
+	jsonPath bool
+}
+
+// Compile parses the query, so that it can be evaluated repeatedly without being parsed again.
+func Compile(query string) (*Query, error) {
+	stages, err := parser.ParsePipeline(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{source: query, stages: stages}, nil
+}
+
+// CompileJSONPath parses an RFC 9535 JSONPath query, such as `$.store.book[?@.price<10].title`.
+// Eval returns its results unique and mapped by their paths like results of other queries,
+// while EvalNodes returns its node list in the order of the selectors, including duplicates.
+func CompileJSONPath(query string) (*Query, error) {
+	parts, err := parser.ParseJSONPath(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{source: query, stages: []parser.Stage{{Parts: parts}}, jsonPath: true}, nil
+}
+
+// MustCompile is like Compile, but it panics if the query cannot be parsed.
+// It is meant for initialization of global variables with constant queries.
+func MustCompile(query string) *Query {
+	q, err := Compile(query)
+	if err != nil {
+		panic(`uniquery: Compile(` + query + `): ` + err.Error())
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.source
+}
+
+// WithLimits returns a copy of the query, whose evaluations are restricted by the limits.
+// Exceeding a limit results in a *runner.LimitError.
+func (q *Query) WithLimits(limits runner.Limits) *Query {
+	limited := *q
+	limited.limits = limits
+	return &limited
+}
+
+// Eval evaluates the query on a decoded value, any Go value traversable by reflection (such as a struct or a typed slice)
+// or a document decoded by runner.DecodeJson or runner.DecodeYaml.
+// Results are mapped by their full paths.
+func (q *Query) Eval(root interface{}) (map[string]Element, error) {
+	return q.EvalContext(context.Background(), root)
+}
+
+// EvalContext evaluates the query like Eval, but the evaluation stops with the error of the context when it is cancelled.
+func (q *Query) EvalContext(ctx context.Context, root interface{}) (map[string]Element, error) {
+	return runner.RunPipelineContext(ctx, q.stages, runner.NewElementRoot(root), q.limits)
+}
+
+// One evaluates the query on the root and stores its only result in the value pointed to by target
+// (see runner.Element.Decode). It fails if the query does not have exactly one result.
+func (q *Query) One(root interface{}, target interface{}) error {
+	results, err := q.Eval(root)
+	if err != nil {
+		return err
+	}
+	return runner.DecodeOne(results, target)
+}
+
+// All evaluates the query on the root and stores its results in document order in the slice pointed to by target.
+func (q *Query) All(root interface{}, target interface{}) error {
+	results, err := q.Eval(root)
+	if err != nil {
+		return err
+	}
+	return runner.DecodeAll(results, target)
+}
+
+// EvalNodes evaluates the query on the root and returns its results as a list. Results of JSONPath
+// queries are node lists as defined by RFC 9535, results of other queries are in document order.
+func (q *Query) EvalNodes(root interface{}) ([]Element, error) {
+	return q.EvalNodesContext(context.Background(), root)
+}
+
+// EvalNodesContext is EvalNodes with a context.
+func (q *Query) EvalNodesContext(ctx context.Context, root interface{}) ([]Element, error) {
+	if q.jsonPath {
+		return runner.RunJSONPathContext(ctx, q.stages[0].Parts, runner.NewElementRoot(root), q.limits)
+	}
+
+	results, err := q.EvalContext(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	return runner.Sorted(results), nil
+}
+
+// EvalJSON decodes a JSON document and evaluates the query on it.
+func (q *Query) EvalJSON(r io.Reader) (map[string]Element, error) {
+	return q.EvalJSONContext(context.Background(), r)
+}
+
+// EvalJSONContext is EvalJSON with a context.
+func (q *Query) EvalJSONContext(ctx context.Context, r io.Reader) (map[string]Element, error) {
+	doc, err := runner.DecodeJson(r)
+	if err != nil {
+		return nil, err
+	}
+	return q.EvalContext(ctx, doc)
+}
+
+// EvalYAML decodes a YAML stream and evaluates the query on it.
+func (q *Query) EvalYAML(r io.Reader) (map[string]Element, error) {
+	return q.EvalYAMLContext(context.Background(), r)
+}
+
+// EvalYAMLContext is EvalYAML with a context.
+func (q *Query) EvalYAMLContext(ctx context.Context, r io.Reader) (map[string]Element, error) {
+	doc, err := runner.DecodeYaml(r)
+	if err != nil {
+		return nil, err
+	}
+	return q.EvalContext(ctx, doc)
+}
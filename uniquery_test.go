@@ -0,0 +1,155 @@
+package uniquery
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/natiiix/uniquery/pkg/runner"
+)
+
+const usersJSON string = `[
+	{"name": "John Doe", "debt": 1000, "updated": "2020-01-02T10:00:00Z"},
+	{"name": "Jane Doe", "debt": 0, "updated": "2019-06-30T08:00:00Z"},
+	{"name": "Robert Denver", "debt": 0, "updated": "2020-03-01T00:00:00Z"}
+]`
+
+func TestCompileErrors(t *testing.T) {
+	for _, query := range []string{
+		`.name`,
+		`name"`,
+		`name\`,
+		`name~(`,
+		`name@unknown()`,
+		`name@semver(x.y.z.w)`,
+		`updated@<>2020-01-01`,
+		`name!`,
+		`name | `,
+		`name | nonexistent()`,
+		`name | substr(a)`,
+		`name | group_by(a, b, c)`,
+		`name | count_by(.a)`,
+	} {
+		if q, err := Compile(query); err == nil {
+			t.Errorf("Query `%s` compiled, although it is invalid: %#v", query, q)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	query, err := Compile(`*.debt=0..name | upper()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query.String() != `*.debt=0..name | upper()` {
+		t.Errorf("Unexpected query string: %s", query.String())
+	}
+
+	// The query is evaluated concurrently on many documents, to be checked by the race detector.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				results, err := query.EvalJSON(strings.NewReader(usersJSON))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				names := []string{}
+				for _, e := range runner.Sorted(results) {
+					names = append(names, e.Value.(string))
+				}
+				if strings.Join(names, ",") != "JANE DOE,ROBERT DENVER" {
+					t.Errorf("Unexpected results: %v", names)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	results, err := MustCompile(`*.updated@>=2020-01-01..name`).Eval([]interface{}{
+		map[string]interface{}{"name": "old", "updated": "2019-12-31"},
+		map[string]interface{}{"name": "new", "updated": "2020-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 || results[`1."name"`].Value != "new" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	names := []string{}
+	if err := MustCompile(`*.name`).All([]map[string]string{{"name": "a"}, {"name": "b"}}, &names); err != nil {
+		t.Fatal(err)
+	} else if strings.Join(names, ",") != "a,b" {
+		t.Errorf("Unexpected names: %v", names)
+	}
+
+	var debt int
+	if err := MustCompile(`debt`).One(map[string]interface{}{"debt": 10.0}, &debt); err != nil {
+		t.Fatal(err)
+	} else if debt != 10 {
+		t.Errorf("Unexpected debt: %d", debt)
+	}
+
+	// Numbers keep their precision and their literals.
+	results, err = MustCompile(`*.id=9007199254740993`).EvalJSON(strings.NewReader(`[{"id": 9007199254740992}, {"id": 9007199254740993}]`))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 || results[`1."id"`].Value != json.Number("9007199254740993") {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	results, err = MustCompile(`kind`).EvalYAML(strings.NewReader("kind: Service\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 || results[`"kind"`].Value != "Service" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+}
+
+func TestCompileJSONPath(t *testing.T) {
+	query, err := CompileJSONPath(`$.users[?@.age >= 18].name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	if err := query.All(map[string]interface{}{"users": []interface{}{
+		map[string]interface{}{"name": "a", "age": 17},
+		map[string]interface{}{"name": "b", "age": 18},
+		map[string]interface{}{"name": "c", "age": 30},
+	}}, &names); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Errorf("Unexpected names: %v", names)
+	}
+
+	// Node lists keep the order of the selectors and nodes selected more than once.
+	query, err = CompileJSONPath(`$[1, 0, 1]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := query.EvalNodes([]interface{}{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []interface{}{}
+	for _, node := range nodes {
+		values = append(values, node.Value)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"b", "a", "b"}) {
+		t.Errorf("Unexpected node list: %v", values)
+	}
+
+	if _, err := CompileJSONPath(`users.*.name`); err == nil {
+		t.Error("Query without the root identifier was accepted")
+	}
+}